@@ -0,0 +1,249 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package breaker provides circuit breaker which stops calling failing function for a while.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Default values of Options
+const (
+	defaultFailureThreshold = 5
+	defaultCoolDown         = 10 * time.Second
+	defaultHalfOpenMax      = 1
+)
+
+// ErrOpen is returned by Breaker.Do while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of circuit breaker
+type State int
+
+const (
+	// Calls are passed through
+	Closed State = iota
+	// Calls fail fast without calling the function
+	Open
+	// Limited calls are passed through to check recovery
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Options of Breaker
+type Options struct {
+	// Number of failures to open the breaker.
+	// Zero means 5.
+	FailureThreshold int
+
+	// Failures within this rolling window are counted.
+	// Zero means consecutive failures are counted.
+	Window time.Duration
+
+	// Duration to stay open before half-open.
+	// Zero means 10 sec.
+	CoolDown time.Duration
+
+	// Number of calls passed through while half-open.
+	// Zero means 1.
+	HalfOpenMax int
+
+	// Called on state transition, outside of the lock of the breaker
+	OnStateChange func(from, to State)
+
+	// Current time, time.Now if nil
+	Now func() time.Time
+}
+
+// Circuit breaker
+//
+// Breaker is safe for concurrent use.
+type Breaker struct {
+	opts Options
+
+	mu       sync.Mutex
+	state    State
+	failures []time.Time // times of failures counted
+	openedAt time.Time   // time when the breaker is opened
+	trials   int         // calls passed through while half-open
+}
+
+// New returns closed Breaker
+func New(opts Options) *Breaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = defaultCoolDown
+	}
+	if opts.HalfOpenMax <= 0 {
+		opts.HalfOpenMax = defaultHalfOpenMax
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Breaker{opts: opts}
+}
+
+// State returns current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	notify := b.coolDown(b.opts.Now())
+	s := b.state
+	b.mu.Unlock()
+	notify()
+	return s
+}
+
+// Do calls fn if the breaker allows it, and records the result.
+//
+// It returns ErrOpen without calling fn while the breaker is open.
+// Errors caused by cancellation of ctx are not counted as failures.
+// If fn panics, the call is recorded as failure and the panic is propagated.
+func (b *Breaker) Do(ctx context.Context, fn func(context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	returned := false
+	defer func() {
+		if !returned {
+			b.record(false)
+		}
+	}()
+	err := fn(ctx)
+	returned = true
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		b.cancelled()
+	} else {
+		b.record(err == nil)
+	}
+	return err
+}
+
+// Change state and return func to notify the transition
+func (b *Breaker) setState(to State, now time.Time) func() {
+	from := b.state
+	if from == to {
+		return func() {}
+	}
+	b.state = to
+	b.failures = b.failures[:0]
+	b.trials = 0
+	if to == Open {
+		b.openedAt = now
+	}
+	return func() {
+		if b.opts.OnStateChange != nil {
+			b.opts.OnStateChange(from, to)
+		}
+	}
+}
+
+// Move to half-open if cool-down has passed,
+// and return func to notify the transition
+func (b *Breaker) coolDown(now time.Time) func() {
+	if b.state == Open && !now.Before(b.openedAt.Add(b.opts.CoolDown)) {
+		return b.setState(HalfOpen, now)
+	}
+	return func() {}
+}
+
+// Check whether call is allowed
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	notify := b.coolDown(b.opts.Now())
+	var err error
+	switch b.state {
+	case Open:
+		err = ErrOpen
+	case HalfOpen:
+		if b.trials >= b.opts.HalfOpenMax {
+			err = ErrOpen
+		} else {
+			b.trials++
+		}
+	}
+	b.mu.Unlock()
+	notify()
+	return err
+}
+
+// Release trial of half-open without recording result
+func (b *Breaker) cancelled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// Record result of call
+func (b *Breaker) record(success bool) {
+	b.mu.Lock()
+	now := b.opts.Now()
+	notify := func() {}
+	switch b.state {
+	case Closed:
+		if success {
+			if b.opts.Window == 0 {
+				b.failures = b.failures[:0]
+			}
+			break
+		}
+		b.failures = append(b.failures, now)
+		if b.opts.Window > 0 {
+			// drop failures out of window
+			i := 0
+			for i < len(b.failures) && !b.failures[i].After(now.Add(-b.opts.Window)) {
+				i++
+			}
+			b.failures = append(b.failures[:0], b.failures[i:]...)
+		}
+		if len(b.failures) >= b.opts.FailureThreshold {
+			notify = b.setState(Open, now)
+		}
+	case HalfOpen:
+		if success {
+			notify = b.setState(Closed, now)
+		} else {
+			notify = b.setState(Open, now)
+		}
+	}
+	b.mu.Unlock()
+	notify()
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Clock which is advanced manually
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestBreaker(t *testing.T) {
+	errFail := errors.New("fail")
+	type step struct {
+		// advance clock before call
+		advance time.Duration
+		// result of fn, nil means success
+		result error
+		// expected error returned by Do
+		wantErr error
+		// expected state after call
+		wantState State
+	}
+	tests := []struct {
+		name            string
+		opts            Options
+		steps           []step
+		wantTransitions []string
+	}{
+		{
+			name: "open after consecutive failures",
+			opts: Options{FailureThreshold: 2},
+			steps: []step{
+				{result: errFail, wantErr: errFail, wantState: Closed},
+				{result: nil, wantErr: nil, wantState: Closed},
+				{result: errFail, wantErr: errFail, wantState: Closed},
+				{result: errFail, wantErr: errFail, wantState: Open},
+				{result: nil, wantErr: ErrOpen, wantState: Open},
+			},
+			wantTransitions: []string{"closed->open"},
+		},
+		{
+			name: "failures in rolling window",
+			opts: Options{FailureThreshold: 2, Window: time.Minute},
+			steps: []step{
+				{result: errFail, wantErr: errFail, wantState: Closed},
+				{result: nil, wantErr: nil, wantState: Closed},
+				{advance: 2 * time.Minute, result: errFail, wantErr: errFail, wantState: Closed},
+				{advance: time.Second, result: errFail, wantErr: errFail, wantState: Open},
+			},
+			wantTransitions: []string{"closed->open"},
+		},
+		{
+			name: "recover through half-open",
+			opts: Options{FailureThreshold: 1, CoolDown: time.Minute},
+			steps: []step{
+				{result: errFail, wantErr: errFail, wantState: Open},
+				{advance: 30 * time.Second, result: nil, wantErr: ErrOpen, wantState: Open},
+				{advance: 30 * time.Second, result: nil, wantErr: nil, wantState: Closed},
+			},
+			wantTransitions: []string{"closed->open", "open->half-open", "half-open->closed"},
+		},
+		{
+			name: "fail in half-open",
+			opts: Options{FailureThreshold: 1, CoolDown: time.Minute},
+			steps: []step{
+				{result: errFail, wantErr: errFail, wantState: Open},
+				{advance: time.Minute, result: errFail, wantErr: errFail, wantState: Open},
+				{result: nil, wantErr: ErrOpen, wantState: Open},
+			},
+			wantTransitions: []string{"closed->open", "open->half-open", "half-open->open"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clock := &fakeClock{now: time.Unix(0, 0)}
+			transitions := []string{}
+			opts := tt.opts
+			opts.Now = clock.Now
+			opts.OnStateChange = func(from, to State) {
+				transitions = append(transitions, from.String()+"->"+to.String())
+			}
+			b := New(opts)
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				err := b.Do(context.Background(), func(context.Context) error {
+					return s.result
+				})
+				if !errors.Is(err, s.wantErr) {
+					t.Errorf("step %d: Do() error = %v, want %v", i, err, s.wantErr)
+				}
+				if got := b.State(); got != s.wantState {
+					t.Errorf("step %d: State() = %v, want %v", i, got, s.wantState)
+				}
+			}
+			if !reflect.DeepEqual(transitions, tt.wantTransitions) {
+				t.Errorf("transitions = %v, want %v", transitions, tt.wantTransitions)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenMax(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := New(Options{FailureThreshold: 1, CoolDown: time.Minute, HalfOpenMax: 1, Now: clock.Now})
+	b.Do(context.Background(), func(context.Context) error { return errors.New("fail") })
+	clock.Advance(time.Minute)
+
+	// the second call is rejected while the trial call is running
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(context.Background(), func(context.Context) error {
+			<-release
+			return nil
+		})
+	}()
+	for b.State() != HalfOpen || func() bool { b.mu.Lock(); defer b.mu.Unlock(); return b.trials == 0 }() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Do(context.Background(), func(context.Context) error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Errorf("Do() error = %v, want %v", err, ErrOpen)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Do() error = %v, want nil", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+}
+
+func TestBreakerCancel(t *testing.T) {
+	b := New(Options{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.Do(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+	if err := b.Do(ctx, func(context.Context) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBreakerPanicHalfOpen(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := New(Options{FailureThreshold: 1, CoolDown: time.Minute, Now: clock.Now})
+	b.Do(context.Background(), func(context.Context) error { return errors.New("fail") })
+	clock.Advance(time.Minute)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Do() did not propagate panic")
+			}
+		}()
+		b.Do(context.Background(), func(context.Context) error { panic("trial") })
+	}()
+	// the panicking trial is recorded as failure
+	if got := b.State(); got != Open {
+		t.Errorf("State() after panic = %v, want %v", got, Open)
+	}
+	clock.Advance(time.Minute)
+	if err := b.Do(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Do() after cool-down error = %v, want nil", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+}
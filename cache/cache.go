@@ -0,0 +1,217 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package cache provides in-memory cache with TTL and LRU eviction.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Options of Cache
+type Options struct {
+	// Entries expire after TTL since they are stored.
+	// Zero means entries never expire.
+	TTL time.Duration
+
+	// Least recently used entry is evicted when the number of entries exceeds MaxSize.
+	// Zero means no limit.
+	MaxSize int
+
+	// Current time, time.Now if nil
+	Now func() time.Time
+}
+
+// Entry of Cache, which is the value of list.Element
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time // zero means never expires
+}
+
+// Load in progress
+type call[V any] struct {
+	done  chan struct{} // closed when the load is finished
+	value V
+	err   error
+}
+
+// In-memory cache with TTL and LRU eviction
+//
+// Cache is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	opts Options
+
+	mu      sync.Mutex
+	lru     *list.List // front is the most recently used
+	entries map[K]*list.Element
+	calls   map[K]*call[V]
+}
+
+// New returns empty Cache
+func New[K comparable, V any](opts Options) *Cache[K, V] {
+	if opts.TTL < 0 {
+		opts.TTL = 0
+	}
+	if opts.MaxSize < 0 {
+		opts.MaxSize = 0
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Cache[K, V]{
+		opts:    opts,
+		lru:     list.New(),
+		entries: map[K]*list.Element{},
+		calls:   map[K]*call[V]{},
+	}
+}
+
+// Get returns the value of key, and whether it is found and not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key)
+}
+
+// Set stores the value of key, evicting the least recently used entry if needed
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+// Delete removes the entry of key
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+// Len returns the number of entries including expired ones not yet removed
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// GetOrLoad returns the value of key, calling loader if it is not cached.
+//
+// Concurrent loads of the same key are collapsed into one call of loader,
+// which is called with ctx of the first caller.
+// The other callers wait for the result, or return ctx.Err() when their ctx is done.
+// Errors are not cached, and panic of loader is returned as *ezerr.Error.
+func (c *Cache[K, V]) GetOrLoad(
+	ctx context.Context,
+	key K,
+	loader func(context.Context) (V, error),
+) (V, error) {
+	c.mu.Lock()
+	if v, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return v, nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		case <-cl.done:
+			return cl.value, cl.err
+		}
+	}
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	c.load(ctx, key, cl, loader)
+	return cl.value, cl.err
+}
+
+// Call loader and store the result
+func (c *Cache[K, V]) load(
+	ctx context.Context,
+	key K,
+	cl *call[V],
+	loader func(context.Context) (V, error),
+) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			cl.err = ezerr.FromPanic(rec)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		if cl.err == nil {
+			c.set(key, cl.value)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.value, cl.err = loader(ctx)
+}
+
+// Get value without lock
+func (c *Cache[K, V]) get(key K) (V, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	ent := e.Value.(*entry[K, V])
+	if !ent.expires.IsZero() && !c.opts.Now().Before(ent.expires) {
+		c.remove(e)
+		var zero V
+		return zero, false
+	}
+	c.lru.MoveToFront(e)
+	return ent.value, true
+}
+
+// Set value without lock
+func (c *Cache[K, V]) set(key K, value V) {
+	var expires time.Time
+	if c.opts.TTL > 0 {
+		expires = c.opts.Now().Add(c.opts.TTL)
+	}
+	if e, ok := c.entries[key]; ok {
+		ent := e.Value.(*entry[K, V])
+		ent.value = value
+		ent.expires = expires
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	if c.opts.MaxSize > 0 && c.lru.Len() > c.opts.MaxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Remove element without lock
+func (c *Cache[K, V]) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Clock which is advanced manually
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCache(t *testing.T) {
+	type step struct {
+		// advance clock before the operation
+		advance time.Duration
+		// "set", "get" or "delete"
+		op    string
+		key   string
+		value int
+		// expected result of get
+		wantValue int
+		wantOK    bool
+	}
+	tests := []struct {
+		name    string
+		opts    Options
+		steps   []step
+		wantLen int
+	}{
+		{
+			name: "set and get",
+			steps: []step{
+				{op: "set", key: "a", value: 1},
+				{op: "set", key: "b", value: 2},
+				{op: "set", key: "a", value: 3},
+				{op: "get", key: "a", wantValue: 3, wantOK: true},
+				{op: "get", key: "b", wantValue: 2, wantOK: true},
+				{op: "get", key: "c", wantOK: false},
+			},
+			wantLen: 2,
+		},
+		{
+			name: "delete",
+			steps: []step{
+				{op: "set", key: "a", value: 1},
+				{op: "delete", key: "a"},
+				{op: "delete", key: "b"},
+				{op: "get", key: "a", wantOK: false},
+			},
+			wantLen: 0,
+		},
+		{
+			name: "expire after TTL",
+			opts: Options{TTL: time.Minute},
+			steps: []step{
+				{op: "set", key: "a", value: 1},
+				{advance: 30 * time.Second, op: "set", key: "b", value: 2},
+				{advance: 29 * time.Second, op: "get", key: "a", wantValue: 1, wantOK: true},
+				{advance: time.Second, op: "get", key: "a", wantOK: false},
+				{op: "get", key: "b", wantValue: 2, wantOK: true},
+				{advance: 30 * time.Second, op: "get", key: "b", wantOK: false},
+			},
+			wantLen: 0,
+		},
+		{
+			name: "evict least recently used",
+			opts: Options{MaxSize: 2},
+			steps: []step{
+				{op: "set", key: "a", value: 1},
+				{op: "set", key: "b", value: 2},
+				{op: "get", key: "a", wantValue: 1, wantOK: true},
+				{op: "set", key: "c", value: 3},
+				{op: "get", key: "b", wantOK: false},
+				{op: "get", key: "a", wantValue: 1, wantOK: true},
+				{op: "get", key: "c", wantValue: 3, wantOK: true},
+			},
+			wantLen: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+			tt.opts.Now = clock.Now
+			c := New[string, int](tt.opts)
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				switch s.op {
+				case "set":
+					c.Set(s.key, s.value)
+				case "delete":
+					c.Delete(s.key)
+				case "get":
+					v, ok := c.Get(s.key)
+					if v != s.wantValue || ok != s.wantOK {
+						t.Errorf("step %d: Get(%q) = (%v, %v), want (%v, %v)", i, s.key, v, ok, s.wantValue, s.wantOK)
+					}
+				}
+			}
+			if got := c.Len(); got != tt.wantLen {
+				t.Errorf("Len() = %v, want %v", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	errLoad := errors.New("load")
+	tests := []struct {
+		name   string
+		loader func(context.Context) (int, error)
+		// expected result of the first GetOrLoad
+		want    int
+		wantErr bool
+		// whether the result is cached
+		wantCached bool
+	}{
+		{
+			name:       "loaded",
+			loader:     func(context.Context) (int, error) { return 1, nil },
+			want:       1,
+			wantCached: true,
+		},
+		{
+			name:       "error is not cached",
+			loader:     func(context.Context) (int, error) { return 0, errLoad },
+			wantErr:    true,
+			wantCached: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := New[string, int](Options{})
+			got, err := c.GetOrLoad(context.Background(), "a", tt.loader)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("GetOrLoad() = (%v, %v), want (%v, error %v)", got, err, tt.want, tt.wantErr)
+			}
+			if _, ok := c.Get("a"); ok != tt.wantCached {
+				t.Errorf("cached = %v, want %v", ok, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	c := New[string, int](Options{})
+	_, err := c.GetOrLoad(context.Background(), "a", func(context.Context) (int, error) {
+		panic("load")
+	})
+	var ezErr *ezerr.Error
+	if !errors.As(err, &ezErr) {
+		t.Fatalf("GetOrLoad() error = %v, want *ezerr.Error", err)
+	}
+	// loader is called again after panic
+	got, err := c.GetOrLoad(context.Background(), "a", func(context.Context) (int, error) {
+		return 1, nil
+	})
+	if got != 1 || err != nil {
+		t.Errorf("GetOrLoad() = (%v, %v), want (1, nil)", got, err)
+	}
+}
+
+func TestGetOrLoadCollapse(t *testing.T) {
+	c := New[string, int](Options{})
+	var calls int32
+	release := make(chan struct{})
+	loader := func(context.Context) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 1, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]int, n)
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = c.GetOrLoad(context.Background(), "a", loader)
+		}()
+	}
+	// wait until the load starts, and the others are likely waiting for it
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("loader is called %d times, want 1", got)
+	}
+	for i, r := range results {
+		if r != 1 {
+			t.Errorf("results[%d] = %v, want 1", i, r)
+		}
+	}
+}
+
+func TestGetOrLoadWaiterCancel(t *testing.T) {
+	c := New[string, int](Options{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go c.GetOrLoad(context.Background(), "a", func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetOrLoad(ctx, "a", func(context.Context) (int, error) {
+		t.Errorf("loader is called by waiter")
+		return 0, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -19,55 +19,164 @@
 
 package channel
 
+import (
+	"context"
+	"reflect"
+)
+
 // Type of enumerated value in for statement
-type forEnum[T any] struct {
+type Indexed[T any] struct {
 	I int
 	V T
 }
 
-// Enumerate value and index that are received from channel as forEnum struct
-func Enumerate[T any](c <-chan T) <-chan forEnum[T] {
+// Enumerate value and index that are received from channel as Indexed struct
+func Enumerate[T any](c <-chan T) <-chan Indexed[T] {
+	return EnumerateCtx(context.Background(), c, 0, 1)
+}
+
+// EnumerateCtx enumerates value and index like Enumerate.
+//
+// Index starts from start and is incremented by step.
+// The returned channel is closed when c is closed or ctx is done,
+// so the goroutine does not leak even if the consumer stops reading.
+func EnumerateCtx[T any](
+	ctx context.Context,
+	c <-chan T,
+	start int,
+	step int,
+) <-chan Indexed[T] {
 	if c == nil {
 		return nil
 	}
-	enumChan := make(chan forEnum[T])
+	enumChan := make(chan Indexed[T])
 	go func() {
 		defer close(enumChan)
-		i := 0
-		for v := range c {
-			enumChan <- forEnum[T]{i, v}
-			i++
+		i := start
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-c:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case enumChan <- Indexed[T]{i, v}:
+				}
+				i += step
+			}
 		}
 	}()
 	return enumChan
 }
 
-func Or[T any](channels ...<-chan T) <-chan T {
-	switch len(channels) {
-	case 0:
+// Unenumerate strips indexes from values enumerated by Enumerate
+func Unenumerate[T any](ctx context.Context, c <-chan Indexed[T]) <-chan T {
+	if c == nil {
 		return nil
-	case 1:
-		return channels[0]
 	}
+	valChan := make(chan T)
+	go func() {
+		defer close(valChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-c:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case valChan <- e.V:
+				}
+			}
+		}
+	}()
+	return valChan
+}
+
+// selectCases returns reflect.SelectCase of ctx.Done() and channels in this order.
+func selectCases[T any](ctx context.Context, channels []<-chan T) []reflect.SelectCase {
+	cases := make([]reflect.SelectCase, 0, len(channels)+1)
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+	for _, c := range channels {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(c),
+		})
+	}
+	return cases
+}
 
+// Or returns channel which is closed when any of channels sends a value or
+// is closed, or when ctx is done.
+//
+// Or waits on all channels with a single goroutine using reflect.Select,
+// so the cost does not grow with the nesting of channels.
+// The goroutine is released when the returned channel is closed.
+// If channels is empty and ctx is never done, Or returns nil without goroutine,
+// since nothing can close the returned channel.
+func Or[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	if len(channels) == 0 && ctx.Done() == nil {
+		return nil
+	}
 	orDone := make(chan T)
 	go func() {
 		defer close(orDone)
+		reflect.Select(selectCases(ctx, channels))
+	}()
+	return orDone
+}
 
-		switch len(channels) {
-		case 2:
-			select {
-			case <-channels[0]:
-			case <-channels[1]:
-			}
-		default:
-			select {
-			case <-channels[0]:
-			case <-channels[1]:
-			case <-channels[2]:
-			case <-Or(append(channels[3:], orDone)...):
+// OrValue blocks until any of channels sends a value or is closed.
+//
+// It returns the index of the channel, the received value and whether the
+// channel was closed. If ctx is done first, the index is -1.
+// If channels is empty and ctx is never done, it returns -1 immediately,
+// since there is nothing to wait for.
+func OrValue[T any](ctx context.Context, channels ...<-chan T) (i int, v T, closed bool) {
+	if len(channels) == 0 && ctx.Done() == nil {
+		return -1, v, false
+	}
+	chosen, recv, ok := reflect.Select(selectCases(ctx, channels))
+	if chosen == 0 {
+		return -1, v, false
+	}
+	if ok {
+		// recv holds nil if T is an interface type and nil is sent
+		v, _ = recv.Interface().(T)
+	}
+	return chosen - 1, v, !ok
+}
+
+// And returns channel which is closed when all of channels have sent a value
+// or have been closed, or when ctx is done.
+//
+// The returned channel is closed in the same way in both cases,
+// so callers must check ctx.Err() after it is closed to tell cancellation
+// from completion. If ctx is done, not all of channels may have completed.
+//
+// Like Or, And waits on all channels with a single goroutine.
+func And[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	andDone := make(chan T)
+	go func() {
+		defer close(andDone)
+		cases := selectCases(ctx, channels)
+		for len(cases) > 1 {
+			chosen, _, _ := reflect.Select(cases)
+			if chosen == 0 {
+				return
 			}
+			cases = append(cases[:chosen], cases[chosen+1:]...)
 		}
 	}()
-	return orDone
+	return andDone
 }
@@ -20,10 +20,15 @@
 package channel
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/eztest"
 )
 
 func TestEnumerate(t *testing.T) {
@@ -35,14 +40,14 @@ func TestEnumerate(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want []forEnum[string]
+		want []Indexed[string]
 	}{
 		{
 			name: "normal",
 			args: args{
 				c: conv.Chan("a", "b"),
 			},
-			want: []forEnum[string]{
+			want: []Indexed[string]{
 				{
 					I: 0,
 					V: "a",
@@ -58,7 +63,7 @@ func TestEnumerate(t *testing.T) {
 			args: args{
 				c: closed,
 			},
-			want: []forEnum[string]{},
+			want: []Indexed[string]{},
 		},
 		{
 			name: "nil channel",
@@ -78,3 +83,464 @@ func TestEnumerate(t *testing.T) {
 		})
 	}
 }
+
+func TestEnumerateCtx(t *testing.T) {
+	type args struct {
+		c     <-chan string
+		start int
+		step  int
+	}
+	invoker := eztest.Invoker[args, <-chan Indexed[string]]{
+		Name: "EnumerateCtx",
+		Invoke: func(ctx context.Context, a args) (<-chan Indexed[string], error) {
+			return EnumerateCtx(ctx, a.c, a.start, a.step), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan Indexed[string], []Indexed[string]]{
+		{
+			Name: "start 1",
+			Args: args{
+				c:     conv.Chan("a", "b"),
+				start: 1,
+				step:  1,
+			},
+			Invoker: invoker,
+			Want:    []Indexed[string]{{1, "a"}, {2, "b"}},
+		},
+		{
+			Name: "step -2",
+			Args: args{
+				c:     conv.Chan("a", "b", "c"),
+				start: 10,
+				step:  -2,
+			},
+			Invoker: invoker,
+			Want:    []Indexed[string]{{10, "a"}, {8, "b"}, {6, "c"}},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				c:     conv.Chan("a", "b", "c"),
+				start: 0,
+				step:  1,
+			},
+			Context: eztest.ContextWithCountCancel(2),
+			Invoker: invoker,
+			Want:    []Indexed[string]{{0, "a"}, {1, "b"}},
+		},
+		{
+			Name: "blocked by empty channel, but done after timeout",
+			Args: args{
+				c:     make(chan string),
+				start: 0,
+				step:  1,
+			},
+			Context: eztest.ContextWithTimeout(scaledTime(5)),
+			Invoker: invoker,
+			Want:    []Indexed[string]{},
+		},
+		{
+			Name: "nil channel",
+			Args: args{
+				c:     nil,
+				start: 0,
+				step:  1,
+			},
+			Invoker: invoker,
+			Want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestUnenumerate(t *testing.T) {
+	type args struct {
+		c <-chan Indexed[string]
+	}
+	invoker := eztest.Invoker[args, <-chan string]{
+		Name: "Unenumerate",
+		Invoke: func(ctx context.Context, a args) (<-chan string, error) {
+			return Unenumerate(ctx, a.c), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan string, []string]{
+		{
+			Name: "normal",
+			Args: args{
+				c: Enumerate(conv.Chan("a", "b")),
+			},
+			Invoker: invoker,
+			Want:    []string{"a", "b"},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				c: Enumerate(conv.Chan("a", "b", "c")),
+			},
+			Context: eztest.ContextWithCountCancel(1),
+			Invoker: invoker,
+			Want:    []string{"a"},
+		},
+		{
+			Name: "nil channel",
+			Args: args{
+				c: nil,
+			},
+			Invoker: invoker,
+			Want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+// orRecursive is the former recursive implementation of Or.
+// It is kept to compare performance in BenchmarkOr.
+func orRecursive[T any](channels ...<-chan T) <-chan T {
+	switch len(channels) {
+	case 0:
+		return nil
+	case 1:
+		return channels[0]
+	}
+
+	orDone := make(chan T)
+	go func() {
+		defer close(orDone)
+
+		switch len(channels) {
+		case 2:
+			select {
+			case <-channels[0]:
+			case <-channels[1]:
+			}
+		default:
+			select {
+			case <-channels[0]:
+			case <-channels[1]:
+			case <-channels[2]:
+			case <-orRecursive(append(channels[3:], orDone)...):
+			}
+		}
+	}()
+	return orDone
+}
+
+func TestOr(t *testing.T) {
+	// returns n done channels and closes the i-th one if i >= 0
+	dones := func(n, i int) []<-chan struct{} {
+		chans := make([]<-chan struct{}, n)
+		for j := range chans {
+			c := make(chan struct{})
+			if j == i {
+				close(c)
+			}
+			chans[j] = c
+		}
+		return chans
+	}
+	sent := make(chan struct{}, 1)
+	sent <- struct{}{}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx      context.Context
+		channels []<-chan struct{}
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "first of 1 closed",
+			args: args{
+				ctx:      context.Background(),
+				channels: dones(1, 0),
+			},
+			want: true,
+		},
+		{
+			name: "last of 100 closed",
+			args: args{
+				ctx:      context.Background(),
+				channels: dones(100, 99),
+			},
+			want: true,
+		},
+		{
+			name: "value is sent",
+			args: args{
+				ctx:      context.Background(),
+				channels: append(dones(3, -1), sent),
+			},
+			want: true,
+		},
+		{
+			name: "none closed",
+			args: args{
+				ctx:      context.Background(),
+				channels: dones(100, -1),
+			},
+			want: false,
+		},
+		{
+			name: "no channels",
+			args: args{
+				ctx:      context.Background(),
+				channels: nil,
+			},
+			want: false,
+		},
+		{
+			name: "nil channel",
+			args: args{
+				ctx:      context.Background(),
+				channels: []<-chan struct{}{nil},
+			},
+			want: false,
+		},
+		{
+			name: "context cancelled",
+			args: args{
+				ctx:      cancelled,
+				channels: dones(100, -1),
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := false
+			select {
+			case <-Or(tt.args.ctx, tt.args.channels...):
+				got = true
+			case <-time.After(scaledTime(5)):
+			}
+			if got != tt.want {
+				t.Errorf("Or() closed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrNoChannels(t *testing.T) {
+	before := runtime.NumGoroutine()
+	if got := Or[struct{}](context.Background()); got != nil {
+		t.Errorf("Or() of background without channels = %v, want nil", got)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Or() started goroutine: %d -> %d", before, after)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	or := Or[struct{}](ctx)
+	cancel()
+	select {
+	case <-or:
+	case <-time.After(time.Second):
+		t.Errorf("Or() without channels is not closed by cancel")
+	}
+}
+
+func TestOrValue(t *testing.T) {
+	// returns buffered channel which holds v
+	valueChan := func(v int) <-chan int {
+		c := make(chan int, 1)
+		c <- v
+		return c
+	}
+	closedChan := func() <-chan int {
+		c := make(chan int)
+		close(c)
+		return c
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx      context.Context
+		channels []<-chan int
+	}
+	type want struct {
+		i      int
+		v      int
+		closed bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "value is sent",
+			args: args{
+				ctx:      context.Background(),
+				channels: []<-chan int{make(chan int), valueChan(5)},
+			},
+			want: want{i: 1, v: 5, closed: false},
+		},
+		{
+			name: "channel is closed",
+			args: args{
+				ctx:      context.Background(),
+				channels: []<-chan int{closedChan(), make(chan int)},
+			},
+			want: want{i: 0, v: 0, closed: true},
+		},
+		{
+			name: "context cancelled",
+			args: args{
+				ctx:      cancelled,
+				channels: []<-chan int{make(chan int)},
+			},
+			want: want{i: -1, v: 0, closed: false},
+		},
+		{
+			name: "no channels",
+			args: args{
+				ctx:      context.Background(),
+				channels: nil,
+			},
+			want: want{i: -1, v: 0, closed: false},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got want
+			got.i, got.v, got.closed = OrValue(tt.args.ctx, tt.args.channels...)
+			if got != tt.want {
+				t.Errorf("OrValue() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnd(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx    context.Context
+		n      int
+		closes int
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "all closed",
+			args: args{
+				ctx:    context.Background(),
+				n:      100,
+				closes: 100,
+			},
+			want: true,
+		},
+		{
+			name: "not all closed",
+			args: args{
+				ctx:    context.Background(),
+				n:      100,
+				closes: 99,
+			},
+			want: false,
+		},
+		{
+			name: "no channels",
+			args: args{
+				ctx: context.Background(),
+			},
+			want: true,
+		},
+		{
+			name: "context cancelled",
+			args: args{
+				ctx:    cancelled,
+				n:      2,
+				closes: 0,
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			chans := make([]<-chan struct{}, tt.args.n)
+			for i := range chans {
+				c := make(chan struct{})
+				if i < tt.args.closes {
+					close(c)
+				}
+				chans[i] = c
+			}
+			got := false
+			select {
+			case <-And(tt.args.ctx, chans...):
+				got = true
+			case <-time.After(scaledTime(5)):
+			}
+			if got != tt.want {
+				t.Errorf("And() closed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkOr(b *testing.B) {
+	for _, n := range []int{4, 64, 512} {
+		n := n
+		b.Run(fmt.Sprintf("recursive/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				chans := make([]<-chan struct{}, n)
+				for j := range chans {
+					chans[j] = make(chan struct{})
+				}
+				last := make(chan struct{})
+				chans[n-1] = last
+				or := orRecursive(chans...)
+				close(last)
+				<-or
+			}
+		})
+		b.Run(fmt.Sprintf("select/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				chans := make([]<-chan struct{}, n)
+				for j := range chans {
+					chans[j] = make(chan struct{})
+				}
+				last := make(chan struct{})
+				chans[n-1] = last
+				or := Or(ctx, chans...)
+				close(last)
+				<-or
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+
+	"github.com/ezotaka/golib/breaker"
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Result of applying fn to value received from channel
+type Result[T any, R any] struct {
+	// Value received
+	In T
+	// Value returned by fn
+	Out R
+	// Error returned by fn
+	Err error
+}
+
+// Apply fn to each value received from in through circuit breaker b.
+//
+// While b is open, values fail fast with breaker.ErrOpen without calling fn.
+// Panic of fn is converted to *ezerr.Error and counted as failure.
+// Failed values, including those failed fast, are also put to the dead letter sink
+// given by WithDeadLetter. Error of the sink is reported to Observer.
+func Breaker[T any, R any](
+	ctx context.Context,
+	b *breaker.Breaker,
+	in <-chan T,
+	fn func(context.Context, T) (R, error),
+) <-chan Result[T, R] {
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	p := observe(ctx, "Breaker", in)
+	sink := deadLetterSink(ctx)
+	resultChan := make(chan Result[T, R])
+	go func() {
+		defer close(resultChan)
+		defer p.Stopped()
+		for v := range pl.OrDone(ctx.Done(), nil, in) {
+			p.Received(v)
+			r := Result[T, R]{In: v}
+			r.Err = b.Do(ctx, func(ctx context.Context) error {
+				var err error
+				r.Out, err = safeCall(ctx, fn, v)
+				return err
+			})
+			if r.Err != nil {
+				p.Error(r.Err)
+				if sink != nil {
+					if err := putDeadLetter(ctx, sink, "Breaker", v, r.Err); err != nil {
+						p.Error(err)
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				p.Dropped(r)
+				return
+			case resultChan <- r:
+				p.Emitted(r)
+			}
+		}
+	}()
+	return output(p, resultChan)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/breaker"
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezerr"
+	"github.com/ezotaka/golib/eztest"
+)
+
+func TestBreaker(t *testing.T) {
+	errFail := errors.New("fail")
+	// fails for negative values
+	fn := func(_ context.Context, v int) (int, error) {
+		if v < 0 {
+			return 0, errFail
+		}
+		return v * 10, nil
+	}
+	type args struct {
+		in   <-chan int
+		opts breaker.Options
+	}
+	invoker := eztest.Invoker[args, <-chan Result[int, int]]{
+		Name: "Breaker",
+		Invoke: func(ctx context.Context, a args) (<-chan Result[int, int], error) {
+			return Breaker(ctx, breaker.New(a.opts), a.in, fn), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan Result[int, int], []Result[int, int]]{
+		{
+			Name: "closed",
+			Args: args{
+				in:   conv.Chan(1, -1, 2),
+				opts: breaker.Options{FailureThreshold: 2},
+			},
+			Invoker: invoker,
+			Want: []Result[int, int]{
+				{In: 1, Out: 10},
+				{In: -1, Err: errFail},
+				{In: 2, Out: 20},
+			},
+		},
+		{
+			Name: "fail fast while open",
+			Args: args{
+				in:   conv.Chan(-1, -2, 3, 4),
+				opts: breaker.Options{FailureThreshold: 2, CoolDown: time.Hour},
+			},
+			Invoker: invoker,
+			Want: []Result[int, int]{
+				{In: -1, Err: errFail},
+				{In: -2, Err: errFail},
+				{In: 3, Err: breaker.ErrOpen},
+				{In: 4, Err: breaker.ErrOpen},
+			},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				in: conv.Chan(1, 2, 3),
+			},
+			Context: eztest.ContextWithCountCancel(1),
+			Invoker: invoker,
+			Want: []Result[int, int]{
+				{In: 1, Out: 10},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestBreakerDeadLetter(t *testing.T) {
+	dlc := make(chan DeadLetter, 10)
+	ctx := WithDeadLetter(context.Background(), DeadLetterChan(dlc))
+	b := breaker.New(breaker.Options{FailureThreshold: 2, CoolDown: time.Hour})
+	// failingFn fails for -1, panics for 0, and the breaker is open for 3
+	got := conv.Slice(Breaker(ctx, b, conv.Chan(1, -1, 0, 3), failingFn))
+	close(dlc)
+
+	var e *ezerr.Error
+	if len(got) != 4 || !errors.As(got[2].Err, &e) || e.Misc["panic"] != "zero" {
+		t.Errorf("Breaker() = %+v, want panic converted to error", got)
+	}
+	items := []any{}
+	for dl := range dlc {
+		if dl.Stage != "Breaker" {
+			t.Errorf("stage of dead letter = %q, want Breaker", dl.Stage)
+		}
+		items = append(items, dl.Item)
+	}
+	if want := []any{-1, 0, 3}; !reflect.DeepEqual(items, want) {
+		t.Errorf("dead letter items = %v, want %v", items, want)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default value of CronOptions
+const defaultCronTolerance = time.Second
+
+// Policy for fire times of Cron which are missed
+type MissedPolicy int
+
+const (
+	// Missed fire times are not sent
+	MissedSkip MissedPolicy = iota
+	// The latest of missed fire times is sent once
+	MissedRunOnce
+	// All missed fire times are sent in order
+	MissedRunAll
+)
+
+// Options of Cron
+type CronOptions struct {
+	// Time zone of the schedule, time.Local if nil
+	Location *time.Location
+
+	// Fire time is missed if it can not be sent within Tolerance after it,
+	// because the receiver is slow or the clock jumps.
+	// Zero means 1 sec.
+	Tolerance time.Duration
+
+	// Policy for missed fire times
+	Missed MissedPolicy
+
+	// Current time, time.Now if nil
+	Now func() time.Time
+
+	// Channel which sends after d.
+	// If nil, time.Timer is used, which is stopped when Cron stops.
+	After func(d time.Duration) <-chan time.Time
+}
+
+// Bit set of values allowed in each field of cron expression
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// Range and names of cron field
+type cronBounds struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronBounds{name: "second", min: 0, max: 59}
+	cronMinute = cronBounds{name: "minute", min: 0, max: 59}
+	cronHour   = cronBounds{name: "hour", min: 0, max: 23}
+	cronDom    = cronBounds{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronBounds{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also Sunday
+	cronDow = cronBounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Expressions which can be used instead of 5 fields
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule parsed from cron expression
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow cronField
+	// whether day of month or day of week is restricted by non-* expression
+	domStar, dowStar bool
+}
+
+// ParseCron parses cron expression.
+//
+// The expression has 5 fields (minute, hour, day of month, month and day of week)
+// or 6 fields with leading second. Each field is a comma separated list of
+// "*", a value, or a range "a-b", optionally followed by step "/n".
+// Months and days of week can be names like "jan" and "mon".
+// Macros like "@daily" and "@hourly" are also accepted.
+// If both day of month and day of week are restricted, either of them matches like cron.
+func ParseCron(expr string) (*CronSchedule, error) {
+	if m, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron expression must have 5 or 6 fields: %q", expr)
+	}
+	s := &CronSchedule{}
+	var err error
+	parse := func(field string, b cronBounds) cronField {
+		if err != nil {
+			return 0
+		}
+		var f cronField
+		f, err = parseCronField(field, b)
+		return f
+	}
+	s.second = parse(fields[0], cronSecond)
+	s.minute = parse(fields[1], cronMinute)
+	s.hour = parse(fields[2], cronHour)
+	s.dom = parse(fields[3], cronDom)
+	s.month = parse(fields[4], cronMonth)
+	s.dow = parse(fields[5], cronDow)
+	if err != nil {
+		return nil, err
+	}
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[3], "*")
+	s.dowStar = strings.HasPrefix(fields[5], "*")
+	return s, nil
+}
+
+// Parse a field of cron expression
+func parseCronField(field string, b cronBounds) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step of %s: %q", b.name, part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := b.min, b.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if lo, err = parseCronValue(rng[:i], b); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(rng[i+1:], b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range of %s: %q", b.name, part)
+			}
+		default:
+			v, err := parseCronValue(rng, b)
+			if err != nil {
+				return 0, err
+			}
+			// "a/n" means from a to max by n
+			lo = v
+			if rng == part {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+// Parse a value or name of cron field
+func parseCronValue(s string, b cronBounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < b.min || v > b.max {
+		return 0, fmt.Errorf("invalid %s: %q", b.name, s)
+	}
+	return v, nil
+}
+
+// Whether the day of t matches the schedule
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first fire time after t in the location of t.
+//
+// It returns zero time if there is no fire time within 5 years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if !s.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.hour.has(t.Hour()) {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if !next.After(t) {
+				// the same hour is repeated by daylight saving time
+				next = nextLocalHour(t)
+			}
+			t = next
+			continue
+		}
+		if !s.minute.has(t.Minute()) {
+			t = t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond())).Add(time.Minute)
+			continue
+		}
+		if !s.second.has(t.Second()) {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Start of the local hour after t, measured in elapsed time.
+//
+// Unlike time.Truncate, which works on absolute time, it respects
+// offsets of locations which are not whole hours.
+func nextLocalHour(t time.Time) time.Time {
+	sinceHour := time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+	return t.Add(time.Hour - sinceHour)
+}
+
+// Cron sends fire times of cron expression expr.
+//
+// See ParseCron for the syntax of expr.
+// Fire times are sent when they come, and missed ones are handled by opts.Missed.
+// The returned channel is closed when ctx is done, drained,
+// or there is no more fire time.
+func Cron(ctx context.Context, expr string, opts CronOptions) (<-chan time.Time, error) {
+	sched, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaultCronTolerance
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	// channel which sends after d, and func to stop it
+	after := func(d time.Duration) (<-chan time.Time, func()) {
+		if opts.After != nil {
+			return opts.After(d), func() {}
+		}
+		timer := time.NewTimer(d)
+		return timer.C, func() { timer.Stop() }
+	}
+	now := func() time.Time {
+		return opts.Now().In(opts.Location)
+	}
+
+	p := observe(ctx, "Cron")
+	fireChan := make(chan time.Time)
+	drain := DrainSignal(ctx)
+	go func() {
+		defer close(fireChan)
+		defer p.Stopped()
+		next := sched.Next(now())
+		for !next.IsZero() {
+			// wait until next comes
+			for t := now(); t.Before(next); t = now() {
+				c, stop := after(next.Sub(t))
+				select {
+				case <-ctx.Done():
+					stop()
+					return
+				case <-drain:
+					stop()
+					return
+				case <-c:
+				}
+			}
+			select {
+			case <-drain:
+				return
+			default:
+			}
+
+			fire := next
+			if t := now(); t.Sub(fire) > opts.Tolerance {
+				switch opts.Missed {
+				case MissedSkip:
+					p.Dropped(fire)
+					next = sched.Next(fire)
+					continue
+				case MissedRunOnce:
+					// skip to the latest fire time
+					for n := sched.Next(fire); !n.IsZero() && !n.After(t); n = sched.Next(n) {
+						p.Dropped(fire)
+						fire = n
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case fireChan <- fire:
+				p.Emitted(fire)
+			}
+			next = sched.Next(fire)
+		}
+	}()
+	return output(p, fireChan), nil
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) // Saturday
+	tests := []struct {
+		name    string
+		expr    string
+		from    time.Time
+		want    []time.Time
+		wantErr bool
+	}{
+		{
+			name: "every 5 minutes",
+			expr: "*/5 * * * *",
+			from: base,
+			want: []time.Time{
+				base.Add(5 * time.Minute),
+				base.Add(10 * time.Minute),
+				base.Add(15 * time.Minute),
+			},
+		},
+		{
+			name: "with seconds",
+			expr: "30 */2 * * * *",
+			from: base,
+			want: []time.Time{
+				base.Add(30 * time.Second),
+				base.Add(2*time.Minute + 30*time.Second),
+			},
+		},
+		{
+			name: "list and range with step",
+			expr: "0 1,10-14/2 * * *",
+			from: base,
+			want: []time.Time{
+				base.Add(1 * time.Hour),
+				base.Add(10 * time.Hour),
+				base.Add(12 * time.Hour),
+				base.Add(14 * time.Hour),
+				base.Add(25 * time.Hour),
+			},
+		},
+		{
+			name: "names of month and day of week",
+			expr: "0 9 * FEB mon-tue",
+			from: base,
+			want: []time.Time{
+				time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC),
+				time.Date(2022, 2, 7, 9, 0, 0, 0, time.UTC),
+				time.Date(2022, 2, 8, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 15 * 0",
+			from: base,
+			want: []time.Time{
+				time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 1, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 1, 16, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "Sunday as 7",
+			expr: "0 0 * * 7",
+			from: base,
+			want: []time.Time{
+				time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "macro",
+			expr: "@yearly",
+			from: base,
+			want: []time.Time{
+				time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "February 29",
+			expr: "0 0 29 2 *",
+			from: base,
+			want: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "time zone of from",
+			expr: "0 10 * * *",
+			from: base.In(time.FixedZone("JST", 9*60*60)),
+			want: []time.Time{
+				time.Date(2022, 1, 1, 10, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+			},
+		},
+		{
+			name: "no fire time",
+			expr: "0 0 30 2 *",
+			from: base,
+			want: []time.Time{{}},
+		},
+		{name: "too few fields", expr: "* * * *", wantErr: true},
+		{name: "too many fields", expr: "* * * * * * *", wantErr: true},
+		{name: "out of range", expr: "60 * * * *", wantErr: true},
+		{name: "invalid range", expr: "5-1 * * * *", wantErr: true},
+		{name: "invalid step", expr: "*/0 * * * *", wantErr: true},
+		{name: "invalid name", expr: "* * * foo *", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			from := tt.from
+			for i, want := range tt.want {
+				got := s.Next(from)
+				if !got.Equal(want) {
+					t.Errorf("Next() #%d = %v, want %v", i, got, want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestNextLocalHour(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{
+			name: "whole hour offset",
+			t:    time.Date(2022, 1, 1, 10, 40, 15, 1, time.FixedZone("JST", 9*60*60)),
+			want: time.Date(2022, 1, 1, 11, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+		},
+		{
+			name: "half hour offset",
+			t:    time.Date(2022, 1, 1, 10, 40, 15, 1, ist),
+			want: time.Date(2022, 1, 1, 11, 0, 0, 0, ist),
+		},
+	}
+	if ny, err := time.LoadLocation("America/New_York"); err == nil {
+		// 1:00-2:00 is repeated on 2022-11-06, and 06:30 UTC is 1:30 of the second time
+		tests = append(tests, struct {
+			name string
+			t    time.Time
+			want time.Time
+		}{
+			name: "repeated hour",
+			t:    time.Date(2022, 11, 6, 6, 30, 0, 0, time.UTC).In(ny),
+			want: time.Date(2022, 11, 6, 7, 0, 0, 0, time.UTC),
+		})
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := nextLocalHour(tt.t); !got.Equal(tt.want) {
+				t.Errorf("nextLocalHour() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Clock whose After channels are fired by Advance
+type cronClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []cronWaiter
+}
+
+type cronWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *cronClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *cronClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := cronWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Advance the clock after any goroutine waits for it
+func (c *cronClock) Advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.waiters) > 0 {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-timeout:
+			t.Fatalf("nobody waits for the clock")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = waiters
+}
+
+func TestCron(t *testing.T) {
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time {
+		return base.Add(d)
+	}
+	type step struct {
+		advance time.Duration
+		want    []time.Time
+	}
+	tests := []struct {
+		name  string
+		expr  string
+		opts  CronOptions
+		steps []step
+	}{
+		{
+			name: "fire on time",
+			expr: "*/5 * * * *",
+			steps: []step{
+				{advance: 3 * time.Minute, want: nil},
+				{advance: 2 * time.Minute, want: []time.Time{at(5 * time.Minute)}},
+				{advance: 5 * time.Minute, want: []time.Time{at(10 * time.Minute)}},
+			},
+		},
+		{
+			name: "skip missed",
+			expr: "*/5 * * * *",
+			opts: CronOptions{Missed: MissedSkip},
+			steps: []step{
+				{advance: 22 * time.Minute, want: nil},
+				{advance: 3 * time.Minute, want: []time.Time{at(25 * time.Minute)}},
+			},
+		},
+		{
+			name: "run once for missed",
+			expr: "*/5 * * * *",
+			opts: CronOptions{Missed: MissedRunOnce},
+			steps: []step{
+				{advance: 22 * time.Minute, want: []time.Time{at(20 * time.Minute)}},
+				{advance: 3 * time.Minute, want: []time.Time{at(25 * time.Minute)}},
+			},
+		},
+		{
+			name: "run all missed",
+			expr: "*/5 * * * *",
+			opts: CronOptions{Missed: MissedRunAll},
+			steps: []step{
+				{advance: 22 * time.Minute, want: []time.Time{
+					at(5 * time.Minute), at(10 * time.Minute), at(15 * time.Minute), at(20 * time.Minute),
+				}},
+				{advance: 3 * time.Minute, want: []time.Time{at(25 * time.Minute)}},
+			},
+		},
+		{
+			name: "within tolerance",
+			expr: "*/5 * * * *",
+			opts: CronOptions{Tolerance: 3 * time.Minute},
+			steps: []step{
+				{advance: 7 * time.Minute, want: []time.Time{at(5 * time.Minute)}},
+			},
+		},
+		{
+			name: "time zone",
+			expr: "0 10 * * *",
+			opts: CronOptions{Location: time.FixedZone("JST", 9*60*60)},
+			steps: []step{
+				{advance: time.Hour, want: []time.Time{at(time.Hour)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clock := &cronClock{now: base}
+			tt.opts.Now = clock.Now
+			tt.opts.After = clock.After
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c, err := Cron(ctx, tt.expr, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.steps {
+				clock.Advance(t, s.advance)
+				var got []time.Time
+				for range s.want {
+					select {
+					case v := <-c:
+						got = append(got, v.UTC())
+					case <-time.After(time.Second):
+						t.Fatalf("step %d: timeout, received %v", i, got)
+					}
+				}
+				if !reflect.DeepEqual(got, s.want) {
+					t.Errorf("step %d: Cron() = %v, want %v", i, got, s.want)
+				}
+			}
+			cancel()
+			if got := receiveAll(t, c); len(got) != 0 {
+				t.Errorf("Cron() sent %v unexpectedly", got)
+			}
+		})
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	if _, err := Cron(context.Background(), "invalid", CronOptions{}); err == nil {
+		t.Errorf("Cron() error = nil, want error")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// Column of CSV mapped to field of struct
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// Get columns of struct type t.
+//
+// Column name is taken from `csv:"name"` tag or field name.
+// Fields tagged with `csv:"-"` and unexported fields are skipped.
+func csvColumns(t reflect.Type) ([]csvColumn, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not struct", t)
+	}
+	cols := []csvColumn{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Tag.Get("csv")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = f.Name
+		}
+		cols = append(cols, csvColumn{name: name, index: f.Index})
+	}
+	return cols, nil
+}
+
+// Set CSV field s to struct field v
+func setCSVField(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// Format struct field v as CSV field
+func formatCSVField(v reflect.Value) (string, error) {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported type %v", v.Type())
+	}
+}
+
+// ReadCSV sends rows read from CSV in r as struct T.
+//
+// The first row must be a header.
+// Columns are mapped to fields by `csv:"name"` tag or field name,
+// and columns without fields are ignored.
+func ReadCSV[T any](ctx context.Context, r io.Reader) (<-chan T, <-chan error) {
+	p := observe(ctx, "ReadCSV")
+	cr := csv.NewReader(r)
+	var fields [][]int // index of field for each column, nil if ignored
+	c, errc := readStream(ctx, p, func() (T, error) {
+		var v T
+		if fields == nil {
+			cols, err := csvColumns(reflect.TypeOf(v))
+			if err != nil {
+				return v, err
+			}
+			header, err := cr.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return v, err
+				}
+				return v, fmt.Errorf("read CSV header: %w", err)
+			}
+			fields = make([][]int, len(header))
+			for i, name := range header {
+				for _, c := range cols {
+					if c.name == name {
+						fields[i] = c.index
+					}
+				}
+			}
+		}
+
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return v, err
+			}
+			return v, fmt.Errorf("read CSV: %w", err)
+		}
+		rv := reflect.ValueOf(&v).Elem()
+		for i, s := range row {
+			if i >= len(fields) || fields[i] == nil {
+				continue
+			}
+			if err := setCSVField(rv.FieldByIndex(fields[i]), s); err != nil {
+				line, _ := cr.FieldPos(i)
+				return v, fmt.Errorf("read CSV line %d column %d: %w", line, i+1, err)
+			}
+		}
+		return v, nil
+	})
+	return output(p, c), errc
+}
+
+// WriteCSV writes each value received from in to w as CSV row.
+//
+// The header is written first, using the same column names as ReadCSV.
+func WriteCSV[T any](ctx context.Context, w io.Writer, in <-chan T) error {
+	var zero T
+	cols, err := csvColumns(reflect.TypeOf(zero))
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	flush := func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+	row := make([]string, len(cols))
+	p := observe(ctx, "WriteCSV", in)
+	return writeStream(ctx, p, in, func(v T) error {
+		rv := reflect.ValueOf(v)
+		for i, c := range cols {
+			s, err := formatCSVField(rv.FieldByIndex(c.index))
+			if err != nil {
+				return err
+			}
+			row[i] = s
+		}
+		return cw.Write(row)
+	}, flush)
+}
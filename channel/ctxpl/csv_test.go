@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ezotaka/golib/conv"
+)
+
+type csvRecord struct {
+	Name    string  `csv:"name"`
+	Age     int     `csv:"age"`
+	Score   float64 `csv:"score"`
+	Active  bool
+	Ignored string `csv:"-"`
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []csvRecord
+		wantErr bool
+	}{
+		{
+			name: "rows",
+			s:    "name,age,score,Active\nalice,20,1.5,true\nbob,30,2,false\n",
+			want: []csvRecord{
+				{Name: "alice", Age: 20, Score: 1.5, Active: true},
+				{Name: "bob", Age: 30, Score: 2},
+			},
+		},
+		{
+			name: "columns in other order and unknown column",
+			s:    "unknown,age,name\nx,20,alice\n",
+			want: []csvRecord{
+				{Name: "alice", Age: 20},
+			},
+		},
+		{
+			name: "header only",
+			s:    "name,age\n",
+			want: []csvRecord{},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: []csvRecord{},
+		},
+		{
+			name:    "invalid number",
+			s:       "name,age\nalice,20\nbob,x\n",
+			want:    []csvRecord{{Name: "alice", Age: 20}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := drain(ReadCSV[csvRecord](context.Background(), strings.NewReader(tt.s)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVNotStruct(t *testing.T) {
+	if _, err := drain(ReadCSV[int](context.Background(), strings.NewReader("a\n1\n"))); err == nil {
+		t.Errorf("ReadCSV() doesn't error, want error")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	records := []csvRecord{
+		{Name: "alice", Age: 20, Score: 1.5, Active: true, Ignored: "x"},
+		{Name: "bob, jr.", Age: 30, Score: 2},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteCSV(context.Background(), buf, conv.Chan(records...)); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	want := "name,age,score,Active\nalice,20,1.5,true\n\"bob, jr.\",30,2,false\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCSV() wrote %q, want %q", got, want)
+	}
+
+	// round trip
+	records[0].Ignored = ""
+	got, err := drain(ReadCSV[csvRecord](context.Background(), buf))
+	if err != nil || !reflect.DeepEqual(got, records) {
+		t.Errorf("ReadCSV() = %v, %v, want %v", got, err, records)
+	}
+}
@@ -17,12 +17,13 @@
 // IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
-// TODO: Swap the relationship between donepl and ctxpl
 package ctxpl
 
 import (
 	"context"
 	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
 )
 
 // return channel which is closed when channel or done is closed
@@ -30,71 +31,21 @@ func OrDone[T any](
 	ctx context.Context,
 	channel <-chan T,
 ) <-chan T {
-	valChan := make(chan T)
-	go func() {
-		defer close(valChan)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case v, ok := <-channel:
-				if !ok {
-					return
-				}
-				select {
-				case valChan <- v:
-				case <-ctx.Done():
-				}
-			}
-		}
-	}()
-	return valChan
+	p := observe(ctx, "OrDone", channel)
+	return output(p, pl.OrDone(ctx.Done(), p.Probe(), channel))
 }
 
 func Repeat[T any](ctx context.Context, values ...T) <-chan T {
-	valuesChan := make(chan T)
-	select {
-	case <-ctx.Done():
-		close(valuesChan)
-	default:
-		go func() {
-			defer close(valuesChan)
-			if len(values) == 0 {
-				return
-			}
-			for {
-				for _, v := range values {
-					select {
-					case <-ctx.Done():
-						return
-					case valuesChan <- v:
-					}
-				}
-			}
-		}()
-	}
-	return valuesChan
+	p := observe(ctx, "Repeat")
+	return output(p, pl.Repeat(ctx.Done(), DrainSignal(ctx), p.Probe(), values...))
 }
 
 func RepeatFunc[T any](
 	ctx context.Context,
 	fn func() T,
 ) <-chan T {
-	if fn == nil {
-		panic("fn must not be nil")
-	}
-	valueChan := make(chan T)
-	go func() {
-		defer close(valueChan)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case valueChan <- fn():
-			}
-		}
-	}()
-	return valueChan
+	p := observe(ctx, "RepeatFunc")
+	return output(p, pl.RepeatFunc(ctx.Done(), DrainSignal(ctx), p.Probe(), fn))
 }
 
 func Take[T any](
@@ -102,25 +53,8 @@ func Take[T any](
 	valueChan <-chan T,
 	num int,
 ) <-chan T {
-	if valueChan == nil {
-		return nil
-	}
-	takeChan := make(chan T)
-	go func() {
-		defer close(takeChan)
-		for i := 0; i < num; i++ {
-			select {
-			case <-ctx.Done():
-				return
-			case v, ok := <-valueChan:
-				if !ok {
-					return
-				}
-				takeChan <- v
-			}
-		}
-	}()
-	return takeChan
+	p := observe(ctx, "Take", valueChan)
+	return output(p, pl.Take(ctx.Done(), p.Probe(), valueChan, num))
 }
 
 func Sleep[T any](
@@ -129,53 +63,35 @@ func Sleep[T any](
 	t time.Duration,
 ) <-chan T {
 	if t == 0 {
+		// passthrough stage is not observed
 		return c
 	}
-	ch := make(chan T)
-	go func() {
-		defer close(ch)
-		p := OrDone(ctx, c)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case v, ok := <-p:
-				if !ok {
-					return
-				}
-				select {
-				case <-ctx.Done():
-				case <-time.After(t):
-					ch <- v
-				}
-			}
-		}
-	}()
-	return ch
+	p := observe(ctx, "Sleep", c)
+	return output(p, pl.Sleep(ctx.Done(), p.Probe(), c, t))
 }
 
 // Split the channel into two channels
+//
+// Observer is notified of an emission once per item,
+// after the item is sent to both channels.
 func Tee[T any](
 	ctx context.Context,
 	in <-chan T,
 ) (<-chan T, <-chan T) {
-	out1 := make(chan T)
-	out2 := make(chan T)
-	go func() {
-		defer close(out1)
-		defer close(out2)
-		for val := range OrDone(ctx, in) {
-			var out1, out2 = out1, out2
-			// Writes reliably to two channels
-			for i := 0; i < 2; i++ {
-				select {
-				case out1 <- val:
-					out1 = nil
-				case out2 <- val:
-					out2 = nil
-				}
-			}
-		}
-	}()
-	return out1, out2
+	p := observe(ctx, "Tee", in)
+	out1, out2 := pl.Tee(ctx.Done(), p.Probe(), in)
+	return output(p, out1), output(p, out2)
+}
+
+// Merge channels into one channel, which is closed when all of channels are closed
+func Merge[T any](
+	ctx context.Context,
+	channels ...<-chan T,
+) <-chan T {
+	inputs := make([]any, len(channels))
+	for i, c := range channels {
+		inputs[i] = c
+	}
+	p := observe(ctx, "Merge", inputs...)
+	return output(p, pl.Merge(ctx.Done(), p.Probe(), channels...))
 }
@@ -21,6 +21,8 @@ package ctxpl
 
 import (
 	"context"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -377,3 +379,33 @@ func TestSleep(t *testing.T) {
 		})
 	}
 }
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []<-chan int
+		want     []int
+	}{
+		{
+			name:     "merge channels",
+			channels: []<-chan int{conv.Chan(1, 2), conv.Chan(3), conv.Chan[int]()},
+			want:     []int{1, 2, 3},
+		},
+		{
+			name:     "no channels",
+			channels: nil,
+			want:     []int{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := receiveAll(t, Merge(context.Background(), tt.channels...))
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
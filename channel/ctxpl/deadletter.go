@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Item which a stage failed to process
+type DeadLetter struct {
+	// Name of the stage
+	Stage string
+	// Item received by the stage
+	Item any
+	// Error returned by fn of the stage, or *ezerr.Error if fn panics
+	Err error
+	// Time when the stage failed
+	Time time.Time
+}
+
+// Destination of dead letters
+//
+// Put is called from goroutines of stages, so it must be safe for concurrent use.
+type DeadLetterSink interface {
+	Put(ctx context.Context, dl DeadLetter) error
+}
+
+// DeadLetterFunc is DeadLetterSink calling the function
+type DeadLetterFunc func(ctx context.Context, dl DeadLetter) error
+
+func (f DeadLetterFunc) Put(ctx context.Context, dl DeadLetter) error {
+	return f(ctx, dl)
+}
+
+// DeadLetterChan returns DeadLetterSink which sends dead letters to c.
+//
+// Put blocks until c receives the dead letter or ctx is done.
+func DeadLetterChan(c chan<- DeadLetter) DeadLetterSink {
+	return DeadLetterFunc(func(ctx context.Context, dl DeadLetter) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case c <- dl:
+			return nil
+		}
+	})
+}
+
+// Dead letter encoded in JSON-lines
+type jsonDeadLetter struct {
+	Stage string          `json:"stage"`
+	Item  json.RawMessage `json:"item"`
+	Err   string          `json:"error"`
+	Time  time.Time       `json:"time"`
+}
+
+// DeadLetterJSONLines returns DeadLetterSink which writes dead letters to w as JSON-lines.
+//
+// Each line has "stage", "item", "error" and "time".
+// Item is encoded by encoding/json, so it can be replayed by ReplayDeadLetters.
+func DeadLetterJSONLines(w io.Writer) DeadLetterSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return DeadLetterFunc(func(_ context.Context, dl DeadLetter) error {
+		item, err := json.Marshal(dl.Item)
+		if err != nil {
+			return fmt.Errorf("encode dead letter item: %w", err)
+		}
+		jdl := jsonDeadLetter{
+			Stage: dl.Stage,
+			Item:  item,
+			Time:  dl.Time,
+		}
+		if dl.Err != nil {
+			jdl.Err = dl.Err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return enc.Encode(jdl)
+	})
+}
+
+// ReplayDeadLetters sends items of dead letters written by DeadLetterJSONLines.
+//
+// Items are decoded as T, so they can be sent to the stage again.
+// If stage is not empty, only dead letters of the stage are sent.
+func ReplayDeadLetters[T any](
+	ctx context.Context,
+	r io.Reader,
+	stage string,
+) (<-chan T, <-chan error) {
+	p := observe(ctx, "ReplayDeadLetters")
+	dec := json.NewDecoder(r)
+	c, errc := readStream(ctx, p, func() (T, error) {
+		var v T
+		for {
+			var jdl jsonDeadLetter
+			if err := dec.Decode(&jdl); err != nil {
+				return v, err
+			}
+			if stage != "" && jdl.Stage != stage {
+				continue
+			}
+			err := json.Unmarshal(jdl.Item, &v)
+			return v, err
+		}
+	})
+	return output(p, c), errc
+}
+
+// WithDeadLetter returns context whose stages put failed items to sink.
+//
+// Stages with fn, e.g. Map, put the item to sink and continue
+// when fn returns error or panics.
+func WithDeadLetter(ctx context.Context, sink DeadLetterSink) context.Context {
+	if sink == nil {
+		panic("sink must not be nil")
+	}
+	return context.WithValue(ctx, deadLetterKey, sink)
+}
+
+// DeadLetterSink of ctx given by WithDeadLetter, or nil
+func deadLetterSink(ctx context.Context) DeadLetterSink {
+	sink, _ := ctx.Value(deadLetterKey).(DeadLetterSink)
+	return sink
+}
+
+// Put failed item to sink.
+// It returns the error of sink, or nil if ctx is done.
+func putDeadLetter(ctx context.Context, sink DeadLetterSink, name string, item any, err error) error {
+	dl := DeadLetter{
+		Stage: stageName(ctx, name),
+		Item:  item,
+		Err:   err,
+		Time:  time.Now(),
+	}
+	if err := sink.Put(ctx, dl); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("put dead letter: %w", err)
+	}
+	return nil
+}
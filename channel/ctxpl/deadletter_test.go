@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Error of failingFn
+var errNegative = errors.New("negative")
+
+// fails for negative values, and panics for zero
+func failingFn(_ context.Context, v int) (int, error) {
+	if v < 0 {
+		return 0, errNegative
+	} else if v == 0 {
+		panic("zero")
+	}
+	return v, nil
+}
+
+func TestDeadLetterChan(t *testing.T) {
+	dlc := make(chan DeadLetter, 10)
+	ctx := WithDeadLetter(context.Background(), DeadLetterChan(dlc))
+	got, err := drain(Map(WithStageName(ctx, "enrich"), conv.Chan(1, -1, 0, 2), failingFn))
+	close(dlc)
+	if err != nil {
+		t.Errorf("Map() error = %v", err)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+
+	dls := conv.Slice(dlc)
+	if len(dls) != 2 {
+		t.Fatalf("dead letters = %v, want 2", dls)
+	}
+	if dl := dls[0]; dl.Stage != "enrich" || dl.Item != -1 || dl.Err.Error() != "negative" || dl.Time.IsZero() {
+		t.Errorf("dead letter = %+v, want item -1 of enrich", dl)
+	}
+	var e *ezerr.Error
+	if dl := dls[1]; dl.Item != 0 || !errors.As(dl.Err, &e) || e.Misc["panic"] != "zero" {
+		t.Errorf("dead letter = %+v, want item 0 with panic", dl)
+	}
+}
+
+func TestDeadLetterFunc(t *testing.T) {
+	var mu sync.Mutex
+	items := []any{}
+	sink := DeadLetterFunc(func(_ context.Context, dl DeadLetter) error {
+		mu.Lock()
+		defer mu.Unlock()
+		items = append(items, dl.Item)
+		return nil
+	})
+	ctx := WithDeadLetter(context.Background(), sink)
+	drain(Map(ctx, conv.Chan(-1, -2), failingFn))
+	if want := []any{-1, -2}; !reflect.DeepEqual(items, want) {
+		t.Errorf("dead letter items = %v, want %v", items, want)
+	}
+}
+
+func TestDeadLetterJSONLines(t *testing.T) {
+	type record struct {
+		ID int `json:"id"`
+	}
+	fn := func(_ context.Context, r record) (int, error) {
+		if r.ID%2 == 0 {
+			return 0, errors.New("even")
+		}
+		return r.ID, nil
+	}
+	buf := &bytes.Buffer{}
+	ctx := WithDeadLetter(context.Background(), DeadLetterJSONLines(buf))
+	drain(Map(WithStageName(ctx, "odd"), conv.Chan(record{1}, record{2}, record{4}), fn))
+	drain(Map(WithStageName(ctx, "other"), conv.Chan(record{6}), fn))
+
+	tests := []struct {
+		name  string
+		stage string
+		want  []record
+	}{
+		{
+			name:  "all stages",
+			stage: "",
+			want:  []record{{2}, {4}, {6}},
+		},
+		{
+			name:  "filtered by stage",
+			stage: "odd",
+			want:  []record{{2}, {4}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := drain(ReplayDeadLetters[record](context.Background(), bytes.NewReader(buf.Bytes()), tt.stage))
+			if err != nil {
+				t.Fatalf("ReplayDeadLetters() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReplayDeadLetters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
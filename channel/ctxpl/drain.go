@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ezotaka/golib/ezctx"
+)
+
+// ErrDrainTimeout is the cause of context cancelled by the hard deadline of DrainFunc
+var ErrDrainTimeout = errors.New("drain timeout")
+
+// DrainFunc starts graceful shutdown of pipeline.
+//
+// Sources stop producing values, while the other stages continue to process
+// buffered and in-flight values until their input is closed.
+// The context is cancelled with ErrDrainTimeout after timeout
+// if the pipeline is not finished. Zero timeout means no hard deadline.
+// Only the first call is effective.
+type DrainFunc func(timeout time.Duration)
+
+// Drain state of context
+type drainer struct {
+	once   sync.Once
+	signal chan struct{}
+}
+
+// WithDrain returns context which can be shut down gracefully by DrainFunc,
+// and cancel function of the context.
+//
+// Sources created with the returned context stop producing values when DrainFunc is called.
+// Call cancel when the pipeline is finished, which stops the hard deadline of DrainFunc,
+// so that the finished pipeline is not reported as ErrDrainTimeout.
+func WithDrain(parent context.Context) (context.Context, DrainFunc, context.CancelFunc) {
+	ctx, cancelCause := ezctx.WithCancelCause(parent)
+	d := &drainer{signal: make(chan struct{})}
+	ctx = context.WithValue(ctx, drainKey, d)
+	cancel := func() { cancelCause(context.Canceled) }
+	return ctx, func(timeout time.Duration) {
+		d.once.Do(func() {
+			close(d.signal)
+			if timeout <= 0 {
+				return
+			}
+			go func() {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				select {
+				case <-ctx.Done():
+				case <-timer.C:
+					cancelCause(ErrDrainTimeout)
+				}
+			}()
+		})
+	}, cancel
+}
+
+// DrainSignal returns channel which is closed when DrainFunc of ctx is called.
+//
+// It returns nil if ctx is not given by WithDrain.
+// Custom sources should stop producing values when it is closed.
+func DrainSignal(ctx context.Context) <-chan struct{} {
+	if d, ok := ctx.Value(drainKey).(*drainer); ok {
+		return d.signal
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/ezctx"
+)
+
+// Receive all values from c, or fail after timeout
+func receiveAll[T any](t *testing.T, c <-chan T) []T {
+	t.Helper()
+	got := []T{}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case v, ok := <-c:
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		case <-timeout:
+			t.Fatalf("channel is not closed, received %v", got)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name string
+		// source of the pipeline
+		source func(ctx context.Context) <-chan int
+	}{
+		{
+			name: "Range",
+			source: func(ctx context.Context) <-chan int {
+				return Range(ctx, 0, 1<<30, 1)
+			},
+		},
+		{
+			name: "Unfold",
+			source: func(ctx context.Context) <-chan int {
+				return Unfold(ctx, 0, func(s int) (int, int, bool) { return s, s + 1, true })
+			},
+		},
+		{
+			name: "ReadLines",
+			source: func(ctx context.Context) <-chan int {
+				lines, _ := ReadLines(ctx, &counterReader{})
+				out, _ := Map(ctx, lines, func(_ context.Context, s string) (int, error) {
+					return strconv.Atoi(s)
+				})
+				return out
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := NewSpanRecorder()
+			ctx, drain, cancel := WithDrain(WithObserver(context.Background(), rec))
+			defer cancel()
+			out := Sleep(ctx, tt.source(ctx), time.Millisecond)
+			got := []int{<-out, <-out, <-out}
+			drain(0)
+			got = append(got, receiveAll(t, out)...)
+
+			// no values are lost
+			for i, v := range got {
+				if v != i {
+					t.Fatalf("received %v, want sequence from 0", got)
+				}
+			}
+			if ctx.Err() != nil {
+				t.Errorf("context is cancelled by drain: %v", ezctx.Cause(ctx))
+			}
+			waitStopped(t, rec)
+			for _, s := range rec.Trace() {
+				for _, e := range s.Events {
+					if e.Kind == EventDropped {
+						t.Errorf("%s dropped %s", s.Name, e.Value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	ctx, drain, cancel := WithDrain(context.Background())
+	defer cancel()
+	// Sleep holds the value and waits for the next one
+	in := make(chan int, 1)
+	in <- 1
+	out := Sleep(ctx, in, time.Hour)
+	drain(10 * time.Millisecond)
+	receiveAll(t, out)
+	if cause := ezctx.Cause(ctx); !errors.Is(cause, ErrDrainTimeout) {
+		t.Errorf("ezctx.Cause() = %v, want %v", cause, ErrDrainTimeout)
+	}
+}
+
+func TestDrainFinished(t *testing.T) {
+	ctx, drain, cancel := WithDrain(context.Background())
+	out := Range(ctx, 0, 1<<30, 1)
+	drain(10 * time.Millisecond)
+	receiveAll(t, out)
+	cancel()
+	// wait over the hard deadline
+	time.Sleep(50 * time.Millisecond)
+	if cause := ezctx.Cause(ctx); errors.Is(cause, ErrDrainTimeout) {
+		t.Errorf("ezctx.Cause() of finished pipeline = %v", cause)
+	}
+}
+
+func TestDrainSignal(t *testing.T) {
+	if DrainSignal(context.Background()) != nil {
+		t.Errorf("DrainSignal() of background is not nil")
+	}
+	ctx, drain, cancel := WithDrain(context.Background())
+	defer cancel()
+	drain(0)
+	drain(0) // no panic by second call
+	select {
+	case <-DrainSignal(ctx):
+	default:
+		t.Errorf("DrainSignal() is not closed after drain")
+	}
+}
+
+// Reader of infinite lines "0\n1\n2\n..."
+type counterReader struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (r *counterReader) Read(p []byte) (int, error) {
+	if r.buf.Len() == 0 {
+		r.buf.WriteString(strconv.Itoa(r.n) + "\n")
+		r.n++
+	}
+	return r.buf.Read(p)
+}
+
+var _ io.Reader = (*counterReader)(nil)
@@ -0,0 +1,229 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Default values of ExecOptions
+const (
+	defaultExecGracePeriod = 5 * time.Second
+	defaultExecMaxStderr   = 64 << 10
+)
+
+// Options of Exec
+type ExecOptions struct {
+	// Time to wait for the process to exit after SIGTERM before it is killed.
+	// Zero means 5 sec.
+	GracePeriod time.Duration
+
+	// Max bytes of stderr kept for the error, the last ones are kept.
+	// Zero means 64 KiB.
+	MaxStderr int
+}
+
+// Writer which keeps the last max bytes
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// Exec starts cmd, writes values received from in to its stdin as lines,
+// and sends lines of its stdout without line endings.
+//
+// Stdin is closed when in is closed, and nil in means empty stdin.
+// cmd must not have Stdin, Stdout and Stderr set.
+// When ctx is done, the process gets SIGTERM, and is killed after opts.GracePeriod.
+// Pipes are closed at that time even if child processes of the process keep them open.
+// The error channel receives at most one error, and is closed after the line channel is closed.
+// If the process exits non-zero, the error is *ezerr.Error wrapping *exec.ExitError,
+// with the tail of stderr in Misc["stderr"] and the exit code in Misc["exitCode"].
+func Exec(
+	ctx context.Context,
+	cmd *exec.Cmd,
+	in <-chan string,
+	opts ExecOptions,
+) (<-chan string, <-chan error) {
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultExecGracePeriod
+	}
+	if opts.MaxStderr <= 0 {
+		opts.MaxStderr = defaultExecMaxStderr
+	}
+	p := observe(ctx, "Exec", in)
+	lineChan := make(chan string)
+	errChan := make(chan error, 1)
+	fail := func(err error) {
+		p.Fail(err)
+		errChan <- err
+	}
+
+	stderr := &tailBuffer{max: opts.MaxStderr}
+	stdin, err := cmd.StdinPipe()
+	var stdout, stderrPipe io.ReadCloser
+	if err == nil {
+		stdout, err = cmd.StdoutPipe()
+	}
+	if err == nil {
+		stderrPipe, err = cmd.StderrPipe()
+	}
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		go func() {
+			defer close(errChan)
+			defer close(lineChan)
+			defer p.Stopped()
+			fail(ezerr.Wrap(err, "start %s: %v", cmd.Path, err))
+		}()
+		return output(p, lineChan), errChan
+	}
+
+	// pipes may be kept open by child processes after the process is killed
+	closePipes := func() {
+		stdout.Close()
+		stderrPipe.Close()
+	}
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		io.Copy(stderr, stderrPipe)
+	}()
+
+	// stop the process by ctx until it exits
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			cmd.Process.Kill()
+			closePipes()
+			return
+		}
+		timer := time.NewTimer(opts.GracePeriod)
+		defer timer.Stop()
+		select {
+		case <-exited:
+		case <-timer.C:
+			cmd.Process.Kill()
+			closePipes()
+		}
+	}()
+
+	// write values to stdin
+	go func() {
+		defer stdin.Close()
+		if in == nil {
+			return
+		}
+		w := bufio.NewWriter(stdin)
+		for v := range pl.OrDone(ctx.Done(), nil, in) {
+			p.Received(v)
+			if _, err := w.WriteString(v + "\n"); err != nil {
+				// the process does not read stdin any more
+				return
+			}
+			if len(in) == 0 {
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+		w.Flush()
+	}()
+
+	go func() {
+		defer close(errChan)
+		defer close(lineChan)
+		defer p.Stopped()
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+				select {
+				case <-ctx.Done():
+					p.Dropped(line)
+				case lineChan <- line:
+					p.Emitted(line)
+				}
+			}
+			if err != nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if ctx.Err() == nil {
+			// read the rest to let the process exit
+			io.Copy(io.Discard, stdout)
+		}
+		<-stderrDone
+		err := cmd.Wait()
+		close(exited)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fail(ezerr.Wrap(err, "wait %s: %v", cmd.Path, err))
+			return
+		}
+		e := ezerr.Wrap(err, "%s exited with %d", cmd.Path, exitErr.ExitCode())
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			e.Message += ": " + msg
+		}
+		e.Misc["stderr"] = stderr.String()
+		e.Misc["exitCode"] = exitErr.ExitCode()
+		fail(e)
+	}()
+	return output(p, lineChan), errChan
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Command of shell script, or skip the test if there is no shell
+func shell(t *testing.T, script string) *exec.Cmd {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	return exec.Command("sh", "-c", script)
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		in     <-chan string
+		want   []string
+		// expected exit code, 0 means no error
+		wantCode   int
+		wantStderr string
+	}{
+		{
+			name:   "stdin to stdout",
+			script: "cat",
+			in:     conv.Chan("a", "b", "c"),
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "transform lines",
+			script: "tr a-z A-Z",
+			in:     conv.Chan("hello", "world"),
+			want:   []string{"HELLO", "WORLD"},
+		},
+		{
+			name:   "nil input",
+			script: "echo a; printf b",
+			in:     nil,
+			want:   []string{"a", "b"},
+		},
+		{
+			name:       "non-zero exit",
+			script:     "echo out; echo oops >&2; exit 3",
+			in:         nil,
+			want:       []string{"out"},
+			wantCode:   3,
+			wantStderr: "oops\n",
+		},
+		{
+			name:   "exit without reading stdin",
+			script: "echo done",
+			in:     conv.Chan("a", "b"),
+			want:   []string{"done"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, errc := Exec(context.Background(), shell(t, tt.script), tt.in, ExecOptions{})
+			got := receiveAll(t, c)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Exec() = %v, want %v", got, tt.want)
+			}
+			err := <-errc
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Errorf("Exec() error = %v", err)
+				}
+				return
+			}
+			var ezErr *ezerr.Error
+			var exitErr *exec.ExitError
+			if !errors.As(err, &ezErr) || !errors.As(err, &exitErr) {
+				t.Fatalf("Exec() error = %v, want *ezerr.Error wrapping *exec.ExitError", err)
+			}
+			if code := ezErr.Misc["exitCode"]; code != tt.wantCode {
+				t.Errorf("exitCode = %v, want %v", code, tt.wantCode)
+			}
+			if stderr := ezErr.Misc["stderr"]; stderr != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestExecStartError(t *testing.T) {
+	c, errc := Exec(context.Background(), exec.Command("/nonexistent/command"), nil, ExecOptions{})
+	receiveAll(t, c)
+	var ezErr *ezerr.Error
+	if err := <-errc; !errors.As(err, &ezErr) {
+		t.Errorf("Exec() error = %v, want *ezerr.Error", err)
+	}
+}
+
+func TestExecCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{
+			name:   "terminated",
+			script: "echo started; sleep 10",
+		},
+		{
+			name:   "killed after grace period",
+			script: `trap "" TERM; echo started; sleep 10`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c, errc := Exec(ctx, shell(t, tt.script), nil, ExecOptions{GracePeriod: 50 * time.Millisecond})
+			if line := <-c; line != "started" {
+				t.Fatalf("Exec() = %q, want %q", line, "started")
+			}
+			cancel()
+			receiveAll(t, c)
+			if err := <-errc; err != nil {
+				t.Errorf("Exec() error = %v, want nil after cancel", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Type constraint of numbers sent by Range
+type Number = pl.Number
+
+// return channel which sends the current time every d
+//
+// Ticks are dropped if the receiver is slow, like time.Ticker.
+// It panics if d is not positive.
+func Interval(ctx context.Context, d time.Duration) <-chan time.Time {
+	p := observe(ctx, "Interval")
+	return output(p, pl.Interval(ctx.Done(), DrainSignal(ctx), p.Probe(), d))
+}
+
+// return channel which sends the current time once after d, and is closed
+func Timer(ctx context.Context, d time.Duration) <-chan time.Time {
+	p := observe(ctx, "Timer")
+	return output(p, pl.Timer(ctx.Done(), DrainSignal(ctx), p.Probe(), d))
+}
+
+// return channel which sends numbers from start to end (exclusive) by step
+//
+// It stops early if adding step no longer advances the value,
+// by overflow of integers or by precision of floats.
+// It panics if step is zero.
+func Range[N Number](ctx context.Context, start, end, step N) <-chan N {
+	p := observe(ctx, "Range")
+	return output(p, pl.Range(ctx.Done(), DrainSignal(ctx), p.Probe(), start, end, step))
+}
+
+// return channel which sends values generated by fn from seed
+//
+// fn returns the value to send, the next state,
+// and false when the sequence ends.
+func Unfold[S any, T any](
+	ctx context.Context,
+	seed S,
+	fn func(S) (T, S, bool),
+) <-chan T {
+	p := observe(ctx, "Unfold")
+	return output(p, pl.Unfold(ctx.Done(), DrainSignal(ctx), p.Probe(), seed, fn))
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/eztest"
+)
+
+func TestInterval(t *testing.T) {
+	type args struct {
+		d time.Duration
+	}
+	// count ticks instead of comparing time
+	invoker := eztest.Invoker[args, <-chan int]{
+		Name: "Interval",
+		Invoke: func(ctx context.Context, a args) (<-chan int, error) {
+			c := Interval(ctx, a.d)
+			cnt := make(chan int)
+			go func() {
+				defer close(cnt)
+				for range c {
+					cnt <- 1
+				}
+			}()
+			return cnt, nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan int, []int]{
+		{
+			Name: "3 ticks",
+			Args: args{
+				d: scaledTime(1),
+			},
+			Context: eztest.ContextWithCountCancel(3),
+			Invoker: invoker,
+			Want:    []int{1, 1, 1},
+		},
+		{
+			Name: "no tick before timeout",
+			Args: args{
+				d: scaledTime(100),
+			},
+			Context: eztest.ContextWithTimeout(scaledTime(5)),
+			Invoker: invoker,
+			Want:    []int{},
+		},
+		{
+			Name: "zero duration",
+			Args: args{
+				d: 0,
+			},
+			Invoker: invoker,
+			Panic:   "d must be positive",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestTimer(t *testing.T) {
+	type args struct {
+		d time.Duration
+	}
+	invoker := eztest.Invoker[args, <-chan bool]{
+		Name: "Timer",
+		Invoke: func(ctx context.Context, a args) (<-chan bool, error) {
+			start := time.Now()
+			c := Timer(ctx, a.d)
+			fired := make(chan bool)
+			go func() {
+				defer close(fired)
+				for tm := range c {
+					fired <- tm.Sub(start) >= a.d
+				}
+			}()
+			return fired, nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan bool, []bool]{
+		{
+			Name: "fire once",
+			Args: args{
+				d: scaledTime(1),
+			},
+			Invoker: invoker,
+			Want:    []bool{true},
+		},
+		{
+			Name: "cancelled before fire",
+			Args: args{
+				d: scaledTime(100),
+			},
+			Context: eztest.ContextWithTimeout(scaledTime(5)),
+			Invoker: invoker,
+			Want:    []bool{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	type args struct {
+		start, end, step int8
+	}
+	invoker := eztest.Invoker[args, <-chan int8]{
+		Name: "Range",
+		Invoke: func(ctx context.Context, a args) (<-chan int8, error) {
+			return Range(ctx, a.start, a.end, a.step), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan int8, []int8]{
+		{
+			Name:    "0 to 3",
+			Args:    args{0, 3, 1},
+			Invoker: invoker,
+			Want:    []int8{0, 1, 2},
+		},
+		{
+			Name:    "step 2",
+			Args:    args{0, 5, 2},
+			Invoker: invoker,
+			Want:    []int8{0, 2, 4},
+		},
+		{
+			Name:    "negative step",
+			Args:    args{3, 0, -1},
+			Invoker: invoker,
+			Want:    []int8{3, 2, 1},
+		},
+		{
+			Name:    "empty",
+			Args:    args{3, 0, 1},
+			Invoker: invoker,
+			Want:    []int8{},
+		},
+		{
+			Name:    "stop before overflow",
+			Args:    args{120, 127, 5},
+			Invoker: invoker,
+			Want:    []int8{120, 125},
+		},
+		{
+			Name:    "cancelled by context",
+			Args:    args{0, 100, 1},
+			Context: eztest.ContextWithCountCancel(2),
+			Invoker: invoker,
+			Want:    []int8{0, 1},
+		},
+		{
+			Name:    "zero step",
+			Args:    args{0, 3, 0},
+			Invoker: invoker,
+			Panic:   "step must not be zero",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestRangeFloat(t *testing.T) {
+	tests := []struct {
+		name             string
+		start, end, step float64
+		want             []float64
+	}{
+		{
+			name:  "0 to 1",
+			start: 0, end: 1, step: 0.25,
+			want: []float64{0, 0.25, 0.5, 0.75},
+		},
+		{
+			name:  "step lost in precision",
+			start: 1<<53 - 2, end: 1<<53 + 10, step: 1,
+			want: []float64{1<<53 - 2, 1<<53 - 1, 1 << 53},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := receiveAll(t, Range(context.Background(), tt.start, tt.end, tt.step))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnfold(t *testing.T) {
+	// fibonacci numbers less than max
+	fib := func(max int) func([2]int) (int, [2]int, bool) {
+		return func(s [2]int) (int, [2]int, bool) {
+			return s[0], [2]int{s[1], s[0] + s[1]}, s[0] < max
+		}
+	}
+	type args struct {
+		fn func([2]int) (int, [2]int, bool)
+	}
+	invoker := eztest.Invoker[args, <-chan int]{
+		Name: "Unfold",
+		Invoke: func(ctx context.Context, a args) (<-chan int, error) {
+			return Unfold(ctx, [2]int{0, 1}, a.fn), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan int, []int]{
+		{
+			Name:    "end of sequence",
+			Args:    args{fib(10)},
+			Invoker: invoker,
+			Want:    []int{0, 1, 1, 2, 3, 5, 8},
+		},
+		{
+			Name:    "cancelled by context",
+			Args:    args{fib(100)},
+			Context: eztest.ContextWithCountCancel(4),
+			Invoker: invoker,
+			Want:    []int{0, 1, 1, 2},
+		},
+		{
+			Name:    "nil func",
+			Args:    args{nil},
+			Invoker: invoker,
+			Panic:   "fn must not be nil",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+
+	"github.com/ezotaka/golib/cache"
+	"github.com/ezotaka/golib/channel/internal/pl"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Call fn converting panic to *ezerr.Error
+func safeCall[T any, R any](
+	ctx context.Context,
+	fn func(context.Context, T) (R, error),
+	v T,
+) (r R, err error) {
+	defer ezerr.Recover(&err)
+	return fn(ctx, v)
+}
+
+// Map sends values returned by fn for each value received from in.
+//
+// If fn returns error or panics, the value is put to the dead letter sink
+// given by WithDeadLetter, and Map continues with the next value.
+// If ctx has no dead letter sink, or the sink fails, Map stops
+// and the error is sent to the error channel.
+// The error channel is closed after the value channel.
+func Map[T any, R any](
+	ctx context.Context,
+	in <-chan T,
+	fn func(context.Context, T) (R, error),
+) (<-chan R, <-chan error) {
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	return mapStage(ctx, "Map", in, fn)
+}
+
+// CachedMap is Map which skips fn for keys already cached in c.
+//
+// The key of each value is given by key. Concurrent calls of fn for the same key
+// are collapsed into one by c.GetOrLoad, and errors are not cached.
+func CachedMap[T any, K comparable, R any](
+	ctx context.Context,
+	c *cache.Cache[K, R],
+	in <-chan T,
+	key func(T) K,
+	fn func(context.Context, T) (R, error),
+) (<-chan R, <-chan error) {
+	if c == nil {
+		panic("c must not be nil")
+	}
+	if key == nil {
+		panic("key must not be nil")
+	}
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	return mapStage(ctx, "CachedMap", in, func(ctx context.Context, v T) (R, error) {
+		return c.GetOrLoad(ctx, key(v), func(ctx context.Context) (R, error) {
+			return fn(ctx, v)
+		})
+	})
+}
+
+// Body of Map, named name
+func mapStage[T any, R any](
+	ctx context.Context,
+	name string,
+	in <-chan T,
+	fn func(context.Context, T) (R, error),
+) (<-chan R, <-chan error) {
+	p := observe(ctx, name, in)
+	sink := deadLetterSink(ctx)
+	outChan := make(chan R)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		defer close(outChan)
+		defer p.Stopped()
+		for v := range pl.OrDone(ctx.Done(), nil, in) {
+			p.Received(v)
+			r, err := safeCall(ctx, fn, v)
+			if err != nil {
+				if sink == nil {
+					p.Fail(err)
+					errChan <- err
+					return
+				}
+				p.Error(err)
+				if err := putDeadLetter(ctx, sink, name, v, err); err != nil {
+					p.Fail(err)
+					errChan <- err
+					return
+				}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				p.Dropped(v)
+				return
+			case outChan <- r:
+				p.Emitted(r)
+			}
+		}
+	}()
+	return output(p, outChan), errChan
+}
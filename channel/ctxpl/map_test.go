@@ -0,0 +1,210 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ezotaka/golib/cache"
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/eztest"
+)
+
+func TestMap(t *testing.T) {
+	// fails for negative values, and panics for zero
+	fn := func(_ context.Context, v int) (int, error) {
+		if v < 0 {
+			return 0, errors.New("negative")
+		} else if v == 0 {
+			panic("zero")
+		}
+		return v * 10, nil
+	}
+	// sink which discards dead letters
+	discard := DeadLetterFunc(func(context.Context, DeadLetter) error { return nil })
+	type args struct {
+		in <-chan int
+	}
+	invoker := eztest.Invoker[args, <-chan int]{
+		Name: "Map",
+		Invoke: func(ctx context.Context, a args) (<-chan int, error) {
+			c, _ := Map(ctx, a.in, fn)
+			return c, nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan int, []int]{
+		{
+			Name: "all succeeded",
+			Args: args{
+				in: conv.Chan(1, 2, 3),
+			},
+			Invoker: invoker,
+			Want:    []int{10, 20, 30},
+		},
+		{
+			Name: "continue after error and panic",
+			Args: args{
+				in: conv.Chan(1, -1, 0, 2),
+			},
+			Context: WithDeadLetter(context.Background(), discard),
+			Invoker: invoker,
+			Want:    []int{10, 20},
+		},
+		{
+			Name: "stop at error without dead letter sink",
+			Args: args{
+				in: conv.Chan(1, -1, 2),
+			},
+			Invoker: invoker,
+			Want:    []int{10},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				in: conv.Chan(1, 2, 3),
+			},
+			Context: eztest.ContextWithCountCancel(2),
+			Invoker: invoker,
+			Want:    []int{10, 20},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestMapError(t *testing.T) {
+	errSink := errors.New("sink")
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []int
+		// expected error, or nil
+		wantErr error
+	}{
+		{
+			name:    "no dead letter sink",
+			ctx:     context.Background(),
+			want:    []int{1},
+			wantErr: errNegative,
+		},
+		{
+			name: "sink failed",
+			ctx: WithDeadLetter(context.Background(), DeadLetterFunc(func(context.Context, DeadLetter) error {
+				return errSink
+			})),
+			want:    []int{1},
+			wantErr: errSink,
+		},
+		{
+			name: "sink succeeded",
+			ctx: WithDeadLetter(context.Background(), DeadLetterFunc(func(context.Context, DeadLetter) error {
+				return nil
+			})),
+			want: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := drain(Map(tt.ctx, conv.Chan(1, -1, 2), failingFn))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("Map() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCachedMap(t *testing.T) {
+	type item struct {
+		id   string
+		seq  int
+		fail bool
+	}
+	tests := []struct {
+		name string
+		in   []item
+		want []string
+		// expected number of calls of fn
+		wantCalls int32
+	}{
+		{
+			name: "skip cached keys",
+			in: []item{
+				{id: "a", seq: 1}, {id: "b", seq: 2}, {id: "a", seq: 3}, {id: "a", seq: 4},
+			},
+			want:      []string{"A1", "B2", "A1", "A1"},
+			wantCalls: 2,
+		},
+		{
+			name: "error is not cached",
+			in: []item{
+				{id: "a", seq: 1, fail: true}, {id: "a", seq: 2}, {id: "a", seq: 3},
+			},
+			want:      []string{"A2", "A2"},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls int32
+			fn := func(_ context.Context, v item) (string, error) {
+				atomic.AddInt32(&calls, 1)
+				if v.fail {
+					return "", errors.New("fail")
+				}
+				return fmt.Sprintf("%s%d", strings.ToUpper(v.id), v.seq), nil
+			}
+			key := func(v item) string { return v.id }
+			c := cache.New[string, string](cache.Options{})
+			// failed items are discarded
+			ctx := WithDeadLetter(context.Background(), DeadLetterFunc(func(context.Context, DeadLetter) error {
+				return nil
+			}))
+			out, _ := CachedMap(ctx, c, conv.Chan(tt.in...), key, fn)
+			got := receiveAll(t, out)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CachedMap() = %v, want %v", got, tt.want)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("fn is called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
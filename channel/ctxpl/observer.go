@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+	"github.com/ezotaka/golib/ezctx"
+)
+
+// Stage of pipeline reported to Observer
+type Stage = pl.Stage
+
+// Observer is called by stages to trace items flowing through pipeline.
+//
+// Methods are called from goroutines of stages,
+// so Observer must be safe for concurrent use and should return quickly.
+// StageStopped reports ezctx.Cause of the context if the stage is cancelled.
+type Observer = pl.Observer
+
+// Observer which also traces channels between stages
+type channelObserver interface {
+	Observer
+	// Channel c, which is an output of the stage from, is an input of s
+	inputConnected(s Stage, from uint64, c any)
+}
+
+// Type of context key
+type ctxKey int
+
+const (
+	// Key of tracer
+	tracerKey ctxKey = iota
+	// Key of stage name
+	stageNameKey
+	// Key of DeadLetterSink
+	deadLetterKey
+	// Key of drain state
+	drainKey
+)
+
+// WithObserver returns context whose stages report to obs.
+//
+// Stages created with the returned context, or contexts derived from it,
+// call obs. Stages with other contexts have no overhead of observation.
+func WithObserver(ctx context.Context, obs Observer) context.Context {
+	if obs == nil {
+		panic("obs must not be nil")
+	}
+	var connected func(s Stage, from uint64, c any)
+	if co, ok := obs.(channelObserver); ok {
+		connected = co.inputConnected
+	}
+	return context.WithValue(ctx, tracerKey, pl.NewTracer(obs, connected))
+}
+
+// WithStageName returns context which names stages created with it.
+//
+// The name is reported to Observer and DeadLetter instead of the name of stage function,
+// so that stages of the same function can be distinguished.
+func WithStageName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, stageNameKey, name)
+}
+
+// Name of stage given by WithStageName, or def
+func stageName(ctx context.Context, def string) string {
+	if name, ok := ctx.Value(stageNameKey).(string); ok {
+		return name
+	}
+	return def
+}
+
+// Probe of a stage.
+// Nil *stageProbe observes nothing.
+type stageProbe = pl.StageProbe
+
+// observe starts observation of a stage named name.
+// It returns nil if ctx has no observer.
+func observe(ctx context.Context, name string, inputs ...any) *stageProbe {
+	t, ok := ctx.Value(tracerKey).(*pl.Tracer)
+	if !ok {
+		return nil
+	}
+	return t.Start(stageName(ctx, name), func() error { return ezctx.Cause(ctx) }, inputs...)
+}
+
+// Register c as output of the stage of p, and return c
+func output[T any](p *stageProbe, c <-chan T) <-chan T {
+	return pl.Output(p, c)
+}
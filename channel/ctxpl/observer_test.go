@@ -0,0 +1,241 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezctx"
+	"github.com/ezotaka/golib/eztest"
+)
+
+// Wait until all spans recorded by r are stopped
+func waitStopped(t *testing.T, r *SpanRecorder) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		stopped := true
+		r.mu.Lock()
+		for _, s := range r.spans {
+			if s.End.IsZero() {
+				stopped = false
+			}
+		}
+		r.mu.Unlock()
+		if stopped {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("stages are not stopped")
+}
+
+// Summarize events of span as "kind:value"
+func eventSummary(s *Span) []string {
+	got := []string{}
+	for _, e := range s.Events {
+		got = append(got, e.Kind+":"+e.Value+e.Err)
+	}
+	return got
+}
+
+func TestSpanRecorder(t *testing.T) {
+	rec := NewSpanRecorder()
+	ctx, cancel := context.WithCancel(WithObserver(context.Background(), rec))
+
+	// Repeat -> Tee -> Take
+	//               -> Take
+	out1, out2 := Tee(ctx, Repeat(ctx, 1, 2, 3))
+	take1 := Take(ctx, out1, 2)
+	take2 := Take(ctx, out2, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); conv.Slice(take1) }()
+	go func() { defer wg.Done(); conv.Slice(take2) }()
+	wg.Wait()
+	cancel()
+	waitStopped(t, rec)
+
+	roots := rec.Trace()
+	if len(roots) != 1 || roots[0].Name != "Repeat" {
+		t.Fatalf("Trace() roots = %v, want [Repeat]", roots)
+	}
+	repeat := roots[0]
+	if len(repeat.Children) != 1 || repeat.Children[0].Name != "Tee" {
+		t.Fatalf("children of Repeat = %v, want [Tee]", repeat.Children)
+	}
+	tee := repeat.Children[0]
+	if len(tee.Children) != 2 {
+		t.Fatalf("children of Tee = %v, want 2 Take", tee.Children)
+	}
+	for _, take := range tee.Children {
+		if take.Name != "Take" || !reflect.DeepEqual(take.Inputs, []uint64{tee.ID}) {
+			t.Errorf("child of Tee = %+v, want Take with input %d", take.Stage, tee.ID)
+		}
+		want := []string{"received:1", "emitted:1", "received:2", "emitted:2"}
+		if got := eventSummary(take); !reflect.DeepEqual(got, want) {
+			t.Errorf("events of Take = %v, want %v", got, want)
+		}
+		if take.End.Before(take.Start) {
+			t.Errorf("Take end %v is before start %v", take.End, take.Start)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := rec.WriteJSON(buf); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var decoded []*Span
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON() wrote invalid JSON: %v", err)
+	}
+	if len(decoded) != 1 || decoded[0].Children[0].Children[0].Name != "Take" {
+		t.Errorf("WriteJSON() wrote %s", buf.String())
+	}
+}
+
+func TestSpanRecorderDropAndError(t *testing.T) {
+	rec := NewSpanRecorder()
+	ctx, cancel := context.WithCancel(WithObserver(context.Background(), rec))
+
+	// Sleep drops item on cancel
+	c := Sleep(ctx, conv.Chan(1), time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	conv.Slice(c)
+
+	// ReadJSONLines reports error
+	lines, errc := ReadJSONLines[int](WithObserver(context.Background(), rec), bytes.NewBufferString("x"))
+	drain(lines, errc)
+	waitStopped(t, rec)
+
+	got := map[string][]string{}
+	for _, s := range rec.Trace() {
+		got[s.Name] = eventSummary(s)
+	}
+	if want := []string{"received:1", "dropped:1"}; !reflect.DeepEqual(got["Sleep"], want) {
+		t.Errorf("events of Sleep = %v, want %v", got["Sleep"], want)
+	}
+	if e := got["ReadJSONLines"]; len(e) != 1 || e[0][:6] != "error:" {
+		t.Errorf("events of ReadJSONLines = %v, want an error", e)
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	errUser := errors.New("stopped by user")
+	tests := []struct {
+		name string
+		// run pipeline with ctx and stop it
+		run  func(ctx context.Context, obs Observer)
+		want string
+	}{
+		{
+			name: "completed",
+			run: func(ctx context.Context, _ Observer) {
+				conv.Slice(Take(ctx, conv.Chan(1, 2), 1))
+			},
+			want: "",
+		},
+		{
+			name: "cancelled with cause",
+			run: func(ctx context.Context, _ Observer) {
+				ctx, cancel := ezctx.WithCancelCause(ctx)
+				c := Repeat(ctx, 1)
+				<-c
+				cancel(errUser)
+				conv.Slice(c)
+			},
+			want: errUser.Error(),
+		},
+		{
+			name: "done channel closed",
+			run: func(ctx context.Context, _ Observer) {
+				done := make(chan struct{})
+				ctx, cancel := ezctx.WithDone(ctx, done)
+				defer cancel()
+				c := Repeat(ctx, 1)
+				<-c
+				close(done)
+				conv.Slice(c)
+			},
+			want: ezctx.ErrDoneClosed.Error(),
+		},
+		{
+			name: "count to cancel",
+			run: func(_ context.Context, obs Observer) {
+				channel.RunTest(eztest.Case[int, <-chan int, []int]{
+					Context: WithObserver(eztest.ContextWithCountCancel(1), obs),
+					Invoker: eztest.Invoker[int, <-chan int]{
+						Name: "Repeat",
+						Invoke: func(ctx context.Context, _ int) (<-chan int, error) {
+							return Repeat(ctx, 1), nil
+						},
+					},
+					Want: []int{1},
+				})
+			},
+			want: eztest.ErrCountCancel.Error(),
+		},
+		{
+			name: "failed",
+			run: func(ctx context.Context, _ Observer) {
+				drain(ReadJSONLines[int](ctx, bytes.NewBufferString("x")))
+			},
+			want: "invalid character 'x' looking for beginning of value",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := NewSpanRecorder()
+			tt.run(WithObserver(context.Background(), rec), rec)
+			waitStopped(t, rec)
+			roots := rec.Trace()
+			if len(roots) != 1 {
+				t.Fatalf("Trace() = %v, want 1 stage", roots)
+			}
+			if got := roots[0].Reason; got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserverSleepZero(t *testing.T) {
+	rec := NewSpanRecorder()
+	ctx := WithObserver(context.Background(), rec)
+	in := conv.Chan(1, 2)
+	if out := Sleep(ctx, in, 0); out != in {
+		t.Errorf("Sleep() with zero duration does not pass through input")
+	}
+	if got := rec.Trace(); len(got) != 0 {
+		t.Errorf("Trace() = %v, want no passthrough stage", got)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Kind of SampleStrategy
+type sampleKind int
+
+const (
+	sampleEveryNth sampleKind = iota
+	sampleBernoulli
+	sampleReservoir
+	sampleInterval
+)
+
+// Strategy of Sample, which is given by EveryNth, Bernoulli, Reservoir or PerInterval
+type SampleStrategy struct {
+	kind     sampleKind
+	n        int     // every-Nth
+	p        float64 // Bernoulli
+	k        int     // reservoir
+	seed     int64   // Bernoulli and reservoir
+	interval time.Duration
+
+	// current time of PerInterval, time.Now if nil
+	now func() time.Time
+}
+
+// EveryNth samples the n-th, 2n-th, 3n-th... values
+func EveryNth(n int) SampleStrategy {
+	if n <= 0 {
+		panic("n must be positive")
+	}
+	return SampleStrategy{kind: sampleEveryNth, n: n}
+}
+
+// Bernoulli samples each value independently with probability p.
+//
+// Random numbers are generated from seed, so the same seed gives the same sample.
+func Bernoulli(p float64, seed int64) SampleStrategy {
+	if p < 0 || p > 1 {
+		panic("p must be in [0, 1]")
+	}
+	return SampleStrategy{kind: sampleBernoulli, p: p, seed: seed}
+}
+
+// Reservoir samples k values uniformly from the whole stream.
+//
+// The sample is sent in the received order after the input is closed.
+// Random numbers are generated from seed, so the same seed gives the same sample.
+func Reservoir(k int, seed int64) SampleStrategy {
+	if k <= 0 {
+		panic("k must be positive")
+	}
+	return SampleStrategy{kind: sampleReservoir, k: k, seed: seed}
+}
+
+// PerInterval samples the first value received in each interval d since the last sampled value
+func PerInterval(d time.Duration) SampleStrategy {
+	if d <= 0 {
+		panic("d must be positive")
+	}
+	return SampleStrategy{kind: sampleInterval, interval: d}
+}
+
+// Value in reservoir with received order
+type reservoirItem[T any] struct {
+	i int
+	v T
+}
+
+// Sample sends a sample of values received from in chosen by strategy.
+//
+// Values not sampled are discarded without being reported as dropped.
+func Sample[T any](
+	ctx context.Context,
+	in <-chan T,
+	strategy SampleStrategy,
+) <-chan T {
+	p := observe(ctx, "Sample", in)
+	outChan := make(chan T)
+	send := func(v T) bool {
+		select {
+		case <-ctx.Done():
+			p.Dropped(v)
+			return false
+		case outChan <- v:
+			p.Emitted(v)
+			return true
+		}
+	}
+	go func() {
+		defer close(outChan)
+		defer p.Stopped()
+		if strategy.kind == sampleReservoir {
+			sampleReservoirValues(ctx, p, in, strategy, send)
+			return
+		}
+		rng := rand.New(rand.NewSource(strategy.seed))
+		now := strategy.now
+		if now == nil {
+			now = time.Now
+		}
+		var (
+			count int
+			last  time.Time // time when the last value is sampled
+		)
+		for v := range pl.OrDone(ctx.Done(), nil, in) {
+			p.Received(v)
+			count++
+			var ok bool
+			switch strategy.kind {
+			case sampleEveryNth:
+				ok = count%strategy.n == 0
+			case sampleBernoulli:
+				ok = rng.Float64() < strategy.p
+			case sampleInterval:
+				t := now()
+				if ok = count == 1 || t.Sub(last) >= strategy.interval; ok {
+					last = t
+				}
+			}
+			if ok && !send(v) {
+				return
+			}
+		}
+	}()
+	return output(p, outChan)
+}
+
+// Sample values by reservoir sampling (algorithm R), and send them after in is closed
+func sampleReservoirValues[T any](
+	ctx context.Context,
+	p *stageProbe,
+	in <-chan T,
+	strategy SampleStrategy,
+	send func(T) bool,
+) {
+	rng := rand.New(rand.NewSource(strategy.seed))
+	reservoir := make([]reservoirItem[T], 0, strategy.k)
+	count := 0
+	for v := range pl.OrDone(ctx.Done(), nil, in) {
+		p.Received(v)
+		if count < strategy.k {
+			reservoir = append(reservoir, reservoirItem[T]{i: count, v: v})
+		} else if j := rng.Intn(count + 1); j < strategy.k {
+			reservoir[j] = reservoirItem[T]{i: count, v: v}
+		}
+		count++
+	}
+	if ctx.Err() != nil {
+		for _, r := range reservoir {
+			p.Dropped(r.v)
+		}
+		return
+	}
+	sort.Slice(reservoir, func(i, j int) bool {
+		return reservoir[i].i < reservoir[j].i
+	})
+	for n, r := range reservoir {
+		if !send(r.v) {
+			for _, r := range reservoir[n+1:] {
+				p.Dropped(r.v)
+			}
+			return
+		}
+	}
+}
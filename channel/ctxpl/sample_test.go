@@ -0,0 +1,190 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/eztest"
+)
+
+// Strategy of PerInterval whose clock advances by step on each call
+func perIntervalWithStep(d, step time.Duration) SampleStrategy {
+	s := PerInterval(d)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+	return s
+}
+
+func TestSample(t *testing.T) {
+	type args struct {
+		in       <-chan int
+		strategy SampleStrategy
+	}
+	invoker := eztest.Invoker[args, <-chan int]{
+		Name: "Sample",
+		Invoke: func(ctx context.Context, a args) (<-chan int, error) {
+			return Sample(ctx, a.in, a.strategy), nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan int, []int]{
+		{
+			Name: "every 3rd",
+			Args: args{
+				in:       conv.Chan(1, 2, 3, 4, 5, 6, 7),
+				strategy: EveryNth(3),
+			},
+			Invoker: invoker,
+			Want:    []int{3, 6},
+		},
+		{
+			Name: "every 1st",
+			Args: args{
+				in:       conv.Chan(1, 2, 3),
+				strategy: EveryNth(1),
+			},
+			Invoker: invoker,
+			Want:    []int{1, 2, 3},
+		},
+		{
+			Name: "Bernoulli with probability 1",
+			Args: args{
+				in:       conv.Chan(1, 2, 3),
+				strategy: Bernoulli(1, 0),
+			},
+			Invoker: invoker,
+			Want:    []int{1, 2, 3},
+		},
+		{
+			Name: "Bernoulli with probability 0",
+			Args: args{
+				in:       conv.Chan(1, 2, 3),
+				strategy: Bernoulli(0, 0),
+			},
+			Invoker: invoker,
+			Want:    []int{},
+		},
+		{
+			Name: "reservoir larger than stream",
+			Args: args{
+				in:       conv.Chan(1, 2, 3),
+				strategy: Reservoir(5, 0),
+			},
+			Invoker: invoker,
+			Want:    []int{1, 2, 3},
+		},
+		{
+			Name: "one per interval",
+			Args: args{
+				in: conv.Chan(1, 2, 3, 4, 5, 6, 7),
+				// values are received every 40ms
+				strategy: perIntervalWithStep(100*time.Millisecond, 40*time.Millisecond),
+			},
+			Invoker: invoker,
+			Want:    []int{1, 4, 7},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				in:       conv.Chan(1, 2, 3, 4, 5, 6, 7),
+				strategy: EveryNth(2),
+			},
+			Context: eztest.ContextWithCountCancel(2),
+			Invoker: invoker,
+			Want:    []int{2, 4},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestSampleSeed(t *testing.T) {
+	values := make([]int, 1000)
+	for i := range values {
+		values[i] = i
+	}
+	tests := []struct {
+		name     string
+		strategy func(seed int64) SampleStrategy
+		// expected number of sampled values, or -1 to skip the check
+		wantLen int
+	}{
+		{
+			name:     "Bernoulli",
+			strategy: func(seed int64) SampleStrategy { return Bernoulli(0.1, seed) },
+			wantLen:  -1,
+		},
+		{
+			name:     "reservoir",
+			strategy: func(seed int64) SampleStrategy { return Reservoir(10, seed) },
+			wantLen:  10,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			got1 := receiveAll(t, Sample(ctx, conv.Chan(values...), tt.strategy(1)))
+			got2 := receiveAll(t, Sample(ctx, conv.Chan(values...), tt.strategy(1)))
+			got3 := receiveAll(t, Sample(ctx, conv.Chan(values...), tt.strategy(2)))
+			if !reflect.DeepEqual(got1, got2) {
+				t.Errorf("samples with the same seed differ: %v, %v", got1, got2)
+			}
+			if reflect.DeepEqual(got1, got3) {
+				t.Errorf("samples with different seeds are the same: %v", got1)
+			}
+			if tt.wantLen >= 0 && len(got1) != tt.wantLen {
+				t.Errorf("len(sample) = %v, want %v", len(got1), tt.wantLen)
+			}
+			if !sort.IntsAreSorted(got1) {
+				t.Errorf("sample is not in received order: %v", got1)
+			}
+		})
+	}
+}
+
+func TestSampleReservoirCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	out := Sample(ctx, in, Reservoir(3, 0))
+	in <- 1
+	in <- 2
+	cancel()
+	if got := receiveAll(t, out); len(got) != 0 {
+		t.Errorf("Sample() = %v, want nothing after cancel", got)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Kind of SpanEvent
+const (
+	EventReceived = "received"
+	EventEmitted  = "emitted"
+	EventDropped  = "dropped"
+	EventError    = "error"
+)
+
+// Event recorded in Span
+type SpanEvent struct {
+	Time time.Time `json:"time"`
+	// One of EventReceived, EventEmitted, EventDropped and EventError
+	Kind string `json:"kind"`
+	// Item formatted by fmt.Sprint
+	Value string `json:"value,omitempty"`
+	// Message of error
+	Err string `json:"error,omitempty"`
+}
+
+// Span of stage recorded by SpanRecorder
+type Span struct {
+	Stage
+	Start time.Time `json:"start"`
+	// Zero if the stage is not stopped yet
+	End time.Time `json:"end"`
+	// Reason why the stage is stopped, empty if completed
+	Reason string      `json:"reason,omitempty"`
+	Events []SpanEvent `json:"events"`
+	// Spans of stages which receive the output of this stage
+	Children []*Span `json:"children,omitempty"`
+}
+
+// Observer which records stages and their events as trace tree
+//
+// SpanRecorder keeps all events in memory,
+// so it is intended for tests and debugging.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans map[uint64]*Span
+	order []uint64 // IDs of spans in order of start
+}
+
+// NewSpanRecorder returns empty SpanRecorder
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{spans: map[uint64]*Span{}}
+}
+
+func (r *SpanRecorder) StageStarted(s Stage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans[s.ID] = &Span{Stage: s, Start: time.Now(), Events: []SpanEvent{}}
+	r.order = append(r.order, s.ID)
+}
+
+func (r *SpanRecorder) StageStopped(s Stage, reason error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if span, ok := r.spans[s.ID]; ok {
+		span.End = time.Now()
+		if reason != nil {
+			span.Reason = reason.Error()
+		}
+	}
+}
+
+// Append event to span of s
+func (r *SpanRecorder) addEvent(s Stage, e SpanEvent) {
+	e.Time = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if span, ok := r.spans[s.ID]; ok {
+		span.Events = append(span.Events, e)
+	}
+}
+
+func (r *SpanRecorder) ItemReceived(s Stage, v any) {
+	r.addEvent(s, SpanEvent{Kind: EventReceived, Value: fmt.Sprint(v)})
+}
+
+func (r *SpanRecorder) ItemEmitted(s Stage, v any) {
+	r.addEvent(s, SpanEvent{Kind: EventEmitted, Value: fmt.Sprint(v)})
+}
+
+func (r *SpanRecorder) ItemDropped(s Stage, v any) {
+	r.addEvent(s, SpanEvent{Kind: EventDropped, Value: fmt.Sprint(v)})
+}
+
+func (r *SpanRecorder) Error(s Stage, err error) {
+	r.addEvent(s, SpanEvent{Kind: EventError, Err: err.Error()})
+}
+
+// Trace returns snapshot of recorded spans as trees.
+//
+// Roots are stages without observed inputs.
+// A stage with several inputs, e.g. merge, appears under each of them.
+func (r *SpanRecorder) Trace() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copies := make(map[uint64]*Span, len(r.spans))
+	for _, id := range r.order {
+		span := *r.spans[id]
+		span.Events = append([]SpanEvent{}, span.Events...)
+		span.Children = nil
+		copies[id] = &span
+	}
+	roots := []*Span{}
+	for _, id := range r.order {
+		span := copies[id]
+		if len(span.Inputs) == 0 {
+			roots = append(roots, span)
+		}
+		for _, in := range span.Inputs {
+			if parent, ok := copies[in]; ok {
+				parent.Children = append(parent.Children, span)
+			}
+		}
+	}
+	return roots
+}
+
+// WriteJSON writes trace trees returned by Trace to w as indented JSON
+func (r *SpanRecorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Trace())
+}
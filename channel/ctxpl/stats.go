@@ -0,0 +1,254 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Relative accuracy of percentiles in Summary
+const statsAccuracy = 0.01
+
+// Statistics of values received by Stats
+type Summary struct {
+	// Number of values
+	Count int `json:"count"`
+	// Minimum value
+	Min float64 `json:"min"`
+	// Maximum value
+	Max float64 `json:"max"`
+	// Arithmetic mean
+	Mean float64 `json:"mean"`
+	// Population variance
+	Variance float64 `json:"variance"`
+	// Approximate percentiles within 1% relative error
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	// Whether this is the summary sent after the input is closed
+	Final bool `json:"final"`
+}
+
+// DDSketch, which estimates quantiles with relative accuracy
+//
+// Values are counted in buckets whose bounds grow geometrically by gamma.
+type sketch struct {
+	gamma    float64
+	logGamma float64
+	positive map[int]int // bucket index of value to count
+	negative map[int]int // bucket index of -value to count
+	zeros    int
+	count    int
+	min, max float64 // exact minimum and maximum
+}
+
+func newSketch(accuracy float64) *sketch {
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &sketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: map[int]int{},
+		negative: map[int]int{},
+	}
+}
+
+// Index of bucket containing positive value v
+func (s *sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// Representative value of bucket i
+func (s *sketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+func (s *sketch) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	switch {
+	case v > 0:
+		s.positive[s.index(v)]++
+	case v < 0:
+		s.negative[s.index(-v)]++
+	default:
+		s.zeros++
+	}
+	s.count++
+}
+
+// Quantile returns approximate q-quantile (0 <= q <= 1) of added values
+// by nearest rank, which is exact for the minimum and maximum.
+func (s *sketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	rank := int(math.Ceil(q*float64(s.count))) - 1
+	switch {
+	case rank <= 0:
+		return s.min
+	case rank >= s.count-1:
+		return s.max
+	}
+	return math.Max(s.min, math.Min(s.max, s.bucketValue(rank)))
+}
+
+// Representative value of bucket containing the value of rank
+func (s *sketch) bucketValue(rank int) float64 {
+	seen := 0
+
+	// negative values from the smallest, which has the largest index
+	neg := sortedKeys(s.negative)
+	for i := len(neg) - 1; i >= 0; i-- {
+		seen += s.negative[neg[i]]
+		if seen > rank {
+			return -s.value(neg[i])
+		}
+	}
+	seen += s.zeros
+	if seen > rank {
+		return 0
+	}
+	pos := sortedKeys(s.positive)
+	for _, i := range pos {
+		seen += s.positive[i]
+		if seen > rank {
+			return s.value(i)
+		}
+	}
+	return s.value(pos[len(pos)-1])
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// Running statistics
+type stats struct {
+	summary Summary
+	m2      float64 // sum of squared differences from the mean
+	sketch  *sketch
+}
+
+// Add value by Welford's algorithm
+func (s *stats) add(v float64) {
+	sum := &s.summary
+	sum.Count++
+	if sum.Count == 1 || v < sum.Min {
+		sum.Min = v
+	}
+	if sum.Count == 1 || v > sum.Max {
+		sum.Max = v
+	}
+	delta := v - sum.Mean
+	sum.Mean += delta / float64(sum.Count)
+	s.m2 += delta * (v - sum.Mean)
+	s.sketch.add(v)
+}
+
+// Current summary, whose percentiles are clamped to [Min, Max]
+func (s *stats) current() Summary {
+	sum := s.summary
+	if sum.Count == 0 {
+		return sum
+	}
+	sum.Variance = s.m2 / float64(sum.Count)
+	clamp := func(v float64) float64 {
+		return math.Max(sum.Min, math.Min(sum.Max, v))
+	}
+	sum.P50 = clamp(s.sketch.quantile(0.50))
+	sum.P95 = clamp(s.sketch.quantile(0.95))
+	sum.P99 = clamp(s.sketch.quantile(0.99))
+	return sum
+}
+
+// Stats sends Summary of values received from in.
+//
+// Summary of all values received so far is sent every interval while any value is received,
+// and the final one is sent after in is closed. Zero every means only the final summary is sent.
+// NaN values are ignored.
+func Stats[N Number](
+	ctx context.Context,
+	in <-chan N,
+	every time.Duration,
+) <-chan Summary {
+	p := observe(ctx, "Stats", in)
+	outChan := make(chan Summary)
+	go func() {
+		defer close(outChan)
+		defer p.Stopped()
+		s := &stats{sketch: newSketch(statsAccuracy)}
+		var tick <-chan time.Time
+		if every > 0 {
+			ticker := time.NewTicker(every)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		send := func(sum Summary) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case outChan <- sum:
+				p.Emitted(sum)
+				return true
+			}
+		}
+		values := pl.OrDone(ctx.Done(), nil, in)
+		for {
+			select {
+			case v, ok := <-values:
+				if !ok {
+					if ctx.Err() != nil {
+						return
+					}
+					sum := s.current()
+					sum.Final = true
+					send(sum)
+					return
+				}
+				p.Received(v)
+				if f := float64(v); !math.IsNaN(f) {
+					s.add(f)
+				}
+			case <-tick:
+				if s.summary.Count == 0 {
+					continue
+				}
+				if !send(s.current()) {
+					return
+				}
+			}
+		}
+	}()
+	return output(p, outChan)
+}
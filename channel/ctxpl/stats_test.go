@@ -0,0 +1,211 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/conv"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		values func() []float64
+	}{
+		{
+			name: "sequence",
+			values: func() []float64 {
+				v := make([]float64, 10000)
+				for i := range v {
+					v[i] = float64(i + 1)
+				}
+				return v
+			},
+		},
+		{
+			name: "exponential",
+			values: func() []float64 {
+				v := make([]float64, 10000)
+				for i := range v {
+					v[i] = rng.ExpFloat64() * 100
+				}
+				return v
+			},
+		},
+		{
+			name: "negative and zero",
+			values: func() []float64 {
+				v := make([]float64, 1000)
+				for i := range v {
+					v[i] = float64(i - 500)
+				}
+				return v
+			},
+		},
+	}
+	for _, tt := range tests {
+		values := tt.values()
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSketch(statsAccuracy)
+			for _, v := range values {
+				s.add(v)
+			}
+			sort.Float64s(values)
+			for _, q := range []float64{0, 0.5, 0.95, 0.99, 1} {
+				// nearest rank
+				want := values[0]
+				if rank := int(math.Ceil(q*float64(len(values)))) - 1; rank > 0 {
+					want = values[rank]
+				}
+				got := s.quantile(q)
+				if math.Abs(got-want) > statsAccuracy*math.Abs(want) {
+					t.Errorf("quantile(%v) = %v, want %v within %v", q, got, want, statsAccuracy)
+				}
+			}
+		})
+	}
+}
+
+func TestSketchQuantileSmall(t *testing.T) {
+	s := newSketch(statsAccuracy)
+	for _, v := range []float64{3, 1, 2} {
+		s.add(v)
+	}
+	tests := []struct {
+		q    float64
+		want float64
+		// the minimum and maximum are exact
+		exact bool
+	}{
+		{0, 1, true},
+		{0.5, 2, false},
+		{0.95, 3, true},
+		{0.99, 3, true},
+		{1, 3, true},
+	}
+	for _, tt := range tests {
+		got := s.quantile(tt.q)
+		if (tt.exact && got != tt.want) || math.Abs(got-tt.want) > statsAccuracy*tt.want {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []float64
+		want Summary
+	}{
+		{
+			name: "values",
+			in:   []float64{2, 4, 4, 4, 5, 5, 7, 9},
+			want: Summary{
+				Count: 8, Min: 2, Max: 9, Mean: 5, Variance: 4,
+				P50: 4, P95: 9, P99: 9, Final: true,
+			},
+		},
+		{
+			name: "NaN is ignored",
+			in:   []float64{1, math.NaN(), 3},
+			want: Summary{
+				Count: 2, Min: 1, Max: 3, Mean: 2, Variance: 1,
+				P50: 1, P95: 3, P99: 3, Final: true,
+			},
+		},
+		{
+			name: "empty",
+			in:   []float64{},
+			want: Summary{Final: true},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := receiveAll(t, Stats(context.Background(), conv.Chan(tt.in...), 0))
+			if len(got) != 1 {
+				t.Fatalf("Stats() sent %v, want only final summary", got)
+			}
+			if !summaryNear(got[0], tt.want) {
+				t.Errorf("Stats() = %+v, want %+v", got[0], tt.want)
+			}
+		})
+	}
+}
+
+// Whether percentiles are within the accuracy, and the others are equal
+func summaryNear(got, want Summary) bool {
+	near := func(g, w float64) bool {
+		return math.Abs(g-w) <= statsAccuracy*math.Abs(w)
+	}
+	if !near(got.P50, want.P50) || !near(got.P95, want.P95) || !near(got.P99, want.P99) {
+		return false
+	}
+	got.P50, got.P95, got.P99 = want.P50, want.P95, want.P99
+	return got == want
+}
+
+func TestStatsPeriodic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan int)
+	out := Stats(ctx, in, 10*time.Millisecond)
+	in <- 1
+	in <- 2
+	in <- 3
+
+	timeout := time.After(time.Second)
+	select {
+	case sum := <-out:
+		if sum.Count != 3 || sum.Mean != 2 || sum.Final {
+			t.Errorf("periodic summary = %+v, want count 3, mean 2", sum)
+		}
+	case <-timeout:
+		t.Fatalf("no periodic summary")
+	}
+
+	in <- 4
+	close(in)
+	// periodic summaries may be sent before the final one
+	got := receiveAll(t, out)
+	final := got[len(got)-1]
+	if final.Count != 4 || final.Max != 4 || !final.Final {
+		t.Errorf("final summary = %+v, want count 4, max 4", final)
+	}
+}
+
+func TestStatsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	out := Stats(ctx, in, 0)
+	in <- 1
+	cancel()
+	if got := receiveAll(t, out); len(got) != 0 {
+		t.Errorf("Stats() = %v, want nothing after cancel", got)
+	}
+}
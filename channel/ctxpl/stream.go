@@ -0,0 +1,174 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Read values from r by read func and send them to the returned channel.
+//
+// read returns io.EOF at the end of stream.
+// The error channel receives at most one error other than io.EOF,
+// and is closed after the value channel is closed.
+// A blocking Read of r is not interrupted by ctx,
+// the goroutine exits after the Read returns.
+// When ctx is drained, the value already read is sent and then the channel is closed.
+func readStream[T any](
+	ctx context.Context,
+	p *stageProbe,
+	read func() (T, error),
+) (<-chan T, <-chan error) {
+	valChan := make(chan T)
+	errChan := make(chan error, 1)
+	drain := DrainSignal(ctx)
+	go func() {
+		defer close(errChan)
+		defer close(valChan)
+		defer p.Stopped()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-drain:
+				return
+			default:
+			}
+			v, err := read()
+			if errors.Is(err, io.EOF) {
+				return
+			} else if err != nil {
+				p.Fail(err)
+				errChan <- err
+				return
+			}
+			select {
+			case <-ctx.Done():
+				p.Dropped(v)
+				return
+			case valChan <- v:
+				p.Emitted(v)
+			}
+		}
+	}()
+	return valChan, errChan
+}
+
+// Write values received from in to w by write func.
+//
+// Buffered data is flushed whenever in has no value ready, and at the end.
+// This function is blocked until in is closed or ctx is done.
+// It returns ctx.Err() if ctx is done.
+func writeStream[T any](
+	ctx context.Context,
+	p *stageProbe,
+	in <-chan T,
+	write func(T) error,
+	flush func() error,
+) (err error) {
+	defer func() {
+		if err != nil && !errors.Is(err, ctx.Err()) {
+			p.Fail(err)
+		}
+		p.Stopped()
+	}()
+	for {
+		var v T
+		var ok bool
+		select {
+		case v, ok = <-in:
+		default:
+			if err := flush(); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case v, ok = <-in:
+			}
+		}
+		if !ok {
+			return flush()
+		}
+		p.Received(v)
+		if err := write(v); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// ReadLines sends lines read from r without line endings.
+func ReadLines(ctx context.Context, r io.Reader) (<-chan string, <-chan error) {
+	p := observe(ctx, "ReadLines")
+	br := bufio.NewReader(r)
+	c, errc := readStream(ctx, p, func() (string, error) {
+		line, err := br.ReadString('\n')
+		if errors.Is(err, io.EOF) && line != "" {
+			err = nil
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+	})
+	return output(p, c), errc
+}
+
+// ReadJSONLines sends records of type T decoded from JSON-lines in r.
+func ReadJSONLines[T any](ctx context.Context, r io.Reader) (<-chan T, <-chan error) {
+	p := observe(ctx, "ReadJSONLines")
+	dec := json.NewDecoder(r)
+	c, errc := readStream(ctx, p, func() (T, error) {
+		var v T
+		err := dec.Decode(&v)
+		return v, err
+	})
+	return output(p, c), errc
+}
+
+// WriteLines writes each value received from in to w as a line.
+func WriteLines(ctx context.Context, w io.Writer, in <-chan string) error {
+	p := observe(ctx, "WriteLines", in)
+	bw := bufio.NewWriter(w)
+	return writeStream(ctx, p, in, func(s string) error {
+		if _, err := bw.WriteString(s); err != nil {
+			return err
+		}
+		return bw.WriteByte('\n')
+	}, bw.Flush)
+}
+
+// WriteJSONLines writes each value received from in to w as JSON-lines.
+func WriteJSONLines[T any](ctx context.Context, w io.Writer, in <-chan T) error {
+	p := observe(ctx, "WriteJSONLines", in)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	return writeStream(ctx, p, in, func(v T) error {
+		return enc.Encode(v)
+	}, bw.Flush)
+}
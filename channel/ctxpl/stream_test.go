@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ezotaka/golib/channel"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/eztest"
+)
+
+// Drain channel and error channel returned by source
+func drain[T any](c <-chan T, errc <-chan error) ([]T, error) {
+	got := conv.Slice(c)
+	return got, <-errc
+}
+
+func TestReadLines(t *testing.T) {
+	type args struct {
+		s string
+	}
+	invoker := eztest.Invoker[args, <-chan string]{
+		Name: "ReadLines",
+		Invoke: func(ctx context.Context, a args) (<-chan string, error) {
+			c, _ := ReadLines(ctx, strings.NewReader(a.s))
+			return c, nil
+		},
+	}
+	tests := []eztest.Case[args, <-chan string, []string]{
+		{
+			Name: "lines",
+			Args: args{
+				s: "a\nb\r\n\nc",
+			},
+			Invoker: invoker,
+			Want:    []string{"a", "b", "", "c"},
+		},
+		{
+			Name: "trailing new line",
+			Args: args{
+				s: "a\n",
+			},
+			Invoker: invoker,
+			Want:    []string{"a"},
+		},
+		{
+			Name: "empty",
+			Args: args{
+				s: "",
+			},
+			Invoker: invoker,
+			Want:    []string{},
+		},
+		{
+			Name: "cancelled by context",
+			Args: args{
+				s: "a\nb\nc\n",
+			},
+			Context: eztest.ContextWithCountCancel(2),
+			Invoker: invoker,
+			Want:    []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := channel.RunTest(tt); err != nil {
+				t.Errorf(err.Error())
+			}
+		})
+	}
+}
+
+func TestReadJSONLines(t *testing.T) {
+	type record struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name    string
+		s       string
+		want    []record
+		wantErr bool
+	}{
+		{
+			name: "records",
+			s:    "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"b\"}\n",
+			want: []record{{1, "a"}, {2, "b"}},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: []record{},
+		},
+		{
+			name:    "broken record",
+			s:       "{\"id\":1,\"name\":\"a\"}\n{\"id\":",
+			want:    []record{{1, "a"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := drain(ReadJSONLines[record](context.Background(), strings.NewReader(tt.s)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadJSONLines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadJSONLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Writer which fails always
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestWriteLines(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		in      <-chan string
+		broken  bool
+		want    string
+		wantErr error
+	}{
+		{
+			name: "lines",
+			ctx:  context.Background(),
+			in:   conv.Chan("a", "b"),
+			want: "a\nb\n",
+		},
+		{
+			name:    "cancelled",
+			ctx:     cancelled,
+			in:      make(chan string),
+			want:    "",
+			wantErr: context.Canceled,
+		},
+		{
+			name:   "broken writer",
+			ctx:    context.Background(),
+			in:     conv.Chan("a"),
+			broken: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if tt.broken {
+				if err := WriteLines(tt.ctx, errWriter{}, tt.in); err == nil {
+					t.Errorf("WriteLines() doesn't error, want error")
+				}
+				return
+			}
+			buf := &bytes.Buffer{}
+			if err := WriteLines(tt.ctx, buf, tt.in); !errors.Is(err, tt.wantErr) {
+				t.Errorf("WriteLines() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteLines() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONLines(t *testing.T) {
+	type record struct {
+		ID int `json:"id"`
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteJSONLines(context.Background(), buf, conv.Chan(record{1}, record{2})); err != nil {
+		t.Fatalf("WriteJSONLines() error = %v", err)
+	}
+	want := "{\"id\":1}\n{\"id\":2}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteJSONLines() wrote %q, want %q", got, want)
+	}
+
+	// round trip
+	got, err := drain(ReadJSONLines[record](context.Background(), buf))
+	if err != nil || !reflect.DeepEqual(got, []record{{1}, {2}}) {
+		t.Errorf("ReadJSONLines() = %v, %v, want %v", got, err, []record{{1}, {2}})
+	}
+}
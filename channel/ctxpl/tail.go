@@ -0,0 +1,253 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default interval to poll the file in Tail
+const defaultTailPollInterval = 250 * time.Millisecond
+
+// Options of Tail
+type TailOptions struct {
+	// Interval to poll the file for appended data, truncation and rotation.
+	// Zero means 250 msec.
+	PollInterval time.Duration
+
+	// Start from the end of the file instead of the beginning.
+	// It is applied only to the first opened file.
+	FromEnd bool
+
+	// Start from this offset, e.g. TailLine.Offset saved before.
+	// It is ignored if FromEnd is true or the file is shorter than Offset.
+	Offset int64
+}
+
+// Line sent by Tail
+type TailLine struct {
+	// Line without line ending
+	Text string
+
+	// Offset just after the line, which can be passed to TailOptions.Offset to resume
+	Offset int64
+}
+
+// File followed by Tail
+type tailFile struct {
+	f       *os.File
+	br      *bufio.Reader
+	offset  int64  // offset of data consumed from f
+	pending string // incomplete last line
+}
+
+func openTailFile(path string) (*tailFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tailFile{f: f, br: bufio.NewReader(f)}, nil
+}
+
+// Seek to offset of file
+func (t *tailFile) seek(offset int64, whence int) error {
+	o, err := t.f.Seek(offset, whence)
+	if err != nil {
+		return err
+	}
+	t.offset = o
+	t.pending = ""
+	t.br.Reset(t.f)
+	return nil
+}
+
+// Read lines until EOF and send them by send func.
+// send returns false if sending is cancelled.
+func (t *tailFile) readLines(send func(TailLine) bool) (bool, error) {
+	for {
+		s, err := t.br.ReadString('\n')
+		t.offset += int64(len(s))
+		if strings.HasSuffix(s, "\n") {
+			line := t.pending + strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+			t.pending = ""
+			if !send(TailLine{Text: line, Offset: t.offset}) {
+				return false, nil
+			}
+		} else {
+			t.pending += s
+		}
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+}
+
+// Tail sends lines appended to the file of path, like `tail -F`.
+//
+// The file is polled every opts.PollInterval.
+// If the file is truncated, Tail reads it again from the beginning.
+// If the file is renamed and a new file is created at path (log rotation),
+// Tail reads the rest of the old file and follows the new one.
+// Tail waits for the file to be created if it does not exist.
+// When ctx is drained, Tail sends lines already written and stops.
+//
+// The error channel receives at most one error,
+// and is closed after the line channel is closed.
+func Tail(ctx context.Context, path string, opts TailOptions) (<-chan TailLine, <-chan error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultTailPollInterval
+	}
+	p := observe(ctx, "Tail")
+	lineChan := make(chan TailLine)
+	errChan := make(chan error, 1)
+
+	send := func(l TailLine) bool {
+		select {
+		case <-ctx.Done():
+			p.Dropped(l)
+			return false
+		case lineChan <- l:
+			p.Emitted(l)
+			return true
+		}
+	}
+	fail := func(err error) {
+		p.Fail(err)
+		errChan <- err
+	}
+	drain := DrainSignal(ctx)
+	wait := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-drain:
+			return false
+		case <-time.After(interval):
+			return true
+		}
+	}
+
+	go func() {
+		defer close(errChan)
+		defer close(lineChan)
+		defer p.Stopped()
+
+		// open the first file
+		var t *tailFile
+		for {
+			var err error
+			t, err = openTailFile(path)
+			if err == nil {
+				break
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				fail(err)
+				return
+			}
+			if !wait() {
+				return
+			}
+		}
+		defer func() { t.f.Close() }()
+
+		var err error
+		if opts.FromEnd {
+			err = t.seek(0, io.SeekEnd)
+		} else if opts.Offset > 0 {
+			if fi, serr := t.f.Stat(); serr != nil {
+				err = serr
+			} else if opts.Offset <= fi.Size() {
+				err = t.seek(opts.Offset, io.SeekStart)
+			}
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for {
+			if ok, err := t.readLines(send); err != nil {
+				fail(err)
+				return
+			} else if !ok {
+				return
+			}
+			if !wait() {
+				return
+			}
+
+			// truncated
+			fi, err := t.f.Stat()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if fi.Size() < t.offset {
+				if err := t.seek(0, io.SeekStart); err != nil {
+					fail(err)
+					return
+				}
+				continue
+			}
+
+			// rotated
+			pfi, err := os.Stat(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				fail(err)
+				return
+			}
+			if os.SameFile(fi, pfi) {
+				continue
+			}
+			next, err := openTailFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				fail(err)
+				return
+			}
+			// read the rest of the old file
+			ok, err := t.readLines(send)
+			if ok && err == nil && t.pending != "" {
+				ok = send(TailLine{Text: t.pending, Offset: t.offset})
+			}
+			t.f.Close()
+			t = next
+			if err != nil {
+				fail(err)
+				return
+			} else if !ok {
+				return
+			}
+		}
+	}()
+	return output(p, lineChan), errChan
+}
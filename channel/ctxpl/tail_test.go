@@ -0,0 +1,167 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Interval to poll file in tests of Tail
+const tailTestInterval = 10 * time.Millisecond
+
+// Receive n lines from c, or fail after timeout
+func receiveLines(t *testing.T, c <-chan TailLine, n int) []TailLine {
+	t.Helper()
+	got := []TailLine{}
+	for len(got) < n {
+		select {
+		case l, ok := <-c:
+			if !ok {
+				t.Fatalf("Tail() closed after %v, want %d lines", got, n)
+			}
+			got = append(got, l)
+		case <-time.After(time.Second):
+			t.Fatalf("Tail() sent %v, want %d lines", got, n)
+		}
+	}
+	return got
+}
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTail(t *testing.T) {
+	tests := []struct {
+		name string
+		// initial content of the file, no file if empty
+		initial string
+		opts    TailOptions
+		// operations after Tail is started
+		ops  func(t *testing.T, path string)
+		want []TailLine
+	}{
+		{
+			name:    "follow appended lines",
+			initial: "a\n",
+			ops: func(t *testing.T, path string) {
+				appendFile(t, path, "b")
+				time.Sleep(3 * tailTestInterval)
+				appendFile(t, path, "c\nd\n")
+			},
+			want: []TailLine{{"a", 2}, {"bc", 5}, {"d", 7}},
+		},
+		{
+			name:    "from end",
+			initial: "a\n",
+			opts:    TailOptions{FromEnd: true},
+			ops: func(t *testing.T, path string) {
+				appendFile(t, path, "b\n")
+			},
+			want: []TailLine{{"b", 4}},
+		},
+		{
+			name:    "from offset",
+			initial: "a\nb\n",
+			opts:    TailOptions{Offset: 2},
+			ops:     func(t *testing.T, path string) {},
+			want:    []TailLine{{"b", 4}},
+		},
+		{
+			name: "wait for creation",
+			ops: func(t *testing.T, path string) {
+				time.Sleep(3 * tailTestInterval)
+				appendFile(t, path, "a\n")
+			},
+			want: []TailLine{{"a", 2}},
+		},
+		{
+			name:    "truncated",
+			initial: "a\nb\n",
+			ops: func(t *testing.T, path string) {
+				time.Sleep(3 * tailTestInterval)
+				if err := os.WriteFile(path, []byte("c\n"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []TailLine{{"a", 2}, {"b", 4}, {"c", 2}},
+		},
+		{
+			name:    "rotated",
+			initial: "a\n",
+			ops: func(t *testing.T, path string) {
+				time.Sleep(3 * tailTestInterval)
+				appendFile(t, path, "b\n")
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "c\n")
+			},
+			want: []TailLine{{"a", 2}, {"b", 4}, {"c", 2}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "test.log")
+			if tt.initial != "" {
+				appendFile(t, path, tt.initial)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			opts := tt.opts
+			opts.PollInterval = tailTestInterval
+			c, errc := Tail(ctx, path, opts)
+			// wait for Tail to open the file
+			time.Sleep(3 * tailTestInterval)
+			tt.ops(t, path)
+
+			got := receiveLines(t, c, len(tt.want))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tail() = %v, want %v", got, tt.want)
+			}
+
+			// stop promptly
+			cancel()
+			select {
+			case err := <-errc:
+				if err != nil {
+					t.Errorf("Tail() error = %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("Tail() is not stopped by context")
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Stage with counters in TopologySnapshot
+type TopologyNode struct {
+	Stage
+	// Number of items received, emitted and dropped
+	Received uint64 `json:"received"`
+	Emitted  uint64 `json:"emitted"`
+	Dropped  uint64 `json:"dropped"`
+	// Number of errors
+	Errors uint64 `json:"errors"`
+	// Whether the stage is not stopped yet
+	Running bool `json:"running"`
+	// Reason why the stage is stopped, empty if completed or running
+	Reason string `json:"reason,omitempty"`
+}
+
+// Channel between stages in TopologySnapshot
+type TopologyEdge struct {
+	// IDs of stages sending and receiving
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+	// Number of items buffered in the channel, and its buffer size
+	Len int `json:"len"`
+	Cap int `json:"cap"`
+}
+
+// Graph of pipeline at a point in time
+type TopologySnapshot struct {
+	// Stages in order of ID
+	Nodes []TopologyNode `json:"nodes"`
+	// Channels in order of From and To
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// Edge with its channel
+type topologyEdge struct {
+	from, to uint64
+	c        reflect.Value
+}
+
+// Observer which records the graph of pipeline with live counters
+//
+// The graph can be exported as Graphviz DOT or Mermaid flowchart,
+// and Topology serves them as http.Handler for debugging.
+// Topology keeps all stages and channels in memory,
+// so it is intended for tests and debugging.
+type Topology struct {
+	mu    sync.Mutex
+	nodes map[uint64]*TopologyNode
+	edges []topologyEdge
+}
+
+// NewTopology returns empty Topology
+func NewTopology() *Topology {
+	return &Topology{nodes: map[uint64]*TopologyNode{}}
+}
+
+func (t *Topology) StageStarted(s Stage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes[s.ID] = &TopologyNode{Stage: s, Running: true}
+}
+
+func (t *Topology) StageStopped(s Stage, reason error) {
+	t.update(s, func(n *TopologyNode) {
+		n.Running = false
+		if reason != nil {
+			n.Reason = reason.Error()
+		}
+	})
+}
+
+func (t *Topology) ItemReceived(s Stage, v any) {
+	t.update(s, func(n *TopologyNode) { n.Received++ })
+}
+
+func (t *Topology) ItemEmitted(s Stage, v any) {
+	t.update(s, func(n *TopologyNode) { n.Emitted++ })
+}
+
+func (t *Topology) ItemDropped(s Stage, v any) {
+	t.update(s, func(n *TopologyNode) { n.Dropped++ })
+}
+
+func (t *Topology) Error(s Stage, err error) {
+	t.update(s, func(n *TopologyNode) { n.Errors++ })
+}
+
+func (t *Topology) inputConnected(s Stage, from uint64, c any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.edges = append(t.edges, topologyEdge{from: from, to: s.ID, c: reflect.ValueOf(c)})
+}
+
+// Update node of s by fn
+func (t *Topology) update(s Stage, fn func(n *TopologyNode)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n, ok := t.nodes[s.ID]; ok {
+		fn(n)
+	}
+}
+
+// Snapshot returns the current graph
+func (t *Topology) Snapshot() TopologySnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snap := TopologySnapshot{
+		Nodes: make([]TopologyNode, 0, len(t.nodes)),
+		Edges: make([]TopologyEdge, 0, len(t.edges)),
+	}
+	for _, n := range t.nodes {
+		snap.Nodes = append(snap.Nodes, *n)
+	}
+	sort.Slice(snap.Nodes, func(i, j int) bool {
+		return snap.Nodes[i].ID < snap.Nodes[j].ID
+	})
+	for _, e := range t.edges {
+		snap.Edges = append(snap.Edges, TopologyEdge{
+			From: e.from,
+			To:   e.to,
+			Len:  e.c.Len(),
+			Cap:  e.c.Cap(),
+		})
+	}
+	sort.SliceStable(snap.Edges, func(i, j int) bool {
+		a, b := snap.Edges[i], snap.Edges[j]
+		return a.From < b.From || (a.From == b.From && a.To < b.To)
+	})
+	return snap
+}
+
+// Lines of label of node
+func (n TopologyNode) labelLines() []string {
+	lines := []string{
+		fmt.Sprintf("%s #%d", n.Name, n.ID),
+		fmt.Sprintf("recv %d / emit %d / drop %d", n.Received, n.Emitted, n.Dropped),
+	}
+	if n.Errors > 0 {
+		lines = append(lines, fmt.Sprintf("errors %d", n.Errors))
+	}
+	switch {
+	case n.Running:
+		lines = append(lines, "running")
+	case n.Reason != "":
+		lines = append(lines, "stopped: "+n.Reason)
+	default:
+		lines = append(lines, "completed")
+	}
+	return lines
+}
+
+// Label of edge
+func (e TopologyEdge) label() string {
+	return fmt.Sprintf("%d/%d", e.Len, e.Cap)
+}
+
+// WriteDOT writes the current graph in Graphviz DOT language.
+//
+// Stages are labeled with counters, and channels with "len/cap" of their buffer.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	snap := t.Snapshot()
+	bw := bufio.NewWriter(w)
+	// DOT escapes only double quotes and backslashes in quoted strings
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	fmt.Fprintln(bw, "digraph pipeline {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	fmt.Fprintln(bw, "  node [shape=box];")
+	for _, n := range snap.Nodes {
+		lines := n.labelLines()
+		for i, l := range lines {
+			lines[i] = quote.Replace(l)
+		}
+		attrs := ""
+		if !n.Running {
+			attrs = ", style=dashed"
+		}
+		if n.Errors > 0 {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(bw, "  s%d [label=\"%s\"%s];\n", n.ID, strings.Join(lines, `\n`), attrs)
+	}
+	for _, e := range snap.Edges {
+		fmt.Fprintf(bw, "  s%d -> s%d [label=\"%s\"];\n", e.From, e.To, e.label())
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteMermaid writes the current graph as Mermaid flowchart.
+//
+// Stages are labeled with counters, and channels with "len/cap" of their buffer.
+func (t *Topology) WriteMermaid(w io.Writer) error {
+	snap := t.Snapshot()
+	bw := bufio.NewWriter(w)
+	// Mermaid labels are escaped by entity codes
+	quote := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, n := range snap.Nodes {
+		lines := n.labelLines()
+		for i, l := range lines {
+			lines[i] = quote.Replace(l)
+		}
+		fmt.Fprintf(bw, "  s%d[\"%s\"]\n", n.ID, strings.Join(lines, "<br/>"))
+	}
+	for _, e := range snap.Edges {
+		fmt.Fprintf(bw, "  s%d -->|\"%s\"| s%d\n", e.From, e.label(), e.To)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the current graph in the format given by query parameter "format",
+// which is "dot" (default), "mermaid" or "json".
+func (t *Topology) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// errors of writing response are ignored, since the header is already sent
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		t.WriteDOT(w)
+	case "mermaid":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		t.WriteMermaid(w)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Snapshot())
+	default:
+		http.Error(w, "unknown format: "+format, http.StatusBadRequest)
+	}
+}
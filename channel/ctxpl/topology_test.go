@@ -0,0 +1,188 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Topology of two stages connected by buffered channel
+func twoStageTopology() *Topology {
+	topo := NewTopology()
+	src := Stage{ID: 1, Name: "Range", Inputs: []uint64{}}
+	dst := Stage{ID: 2, Name: `Map "x"`, Inputs: []uint64{1}}
+	c := make(chan int, 2)
+	c <- 1
+	topo.StageStarted(src)
+	topo.StageStarted(dst)
+	topo.inputConnected(dst, src.ID, c)
+	for i := 0; i < 3; i++ {
+		topo.ItemEmitted(src, i)
+	}
+	topo.StageStopped(src, nil)
+	topo.ItemReceived(dst, 0)
+	topo.ItemReceived(dst, 1)
+	topo.ItemEmitted(dst, 0)
+	topo.Error(dst, errors.New("fail"))
+	topo.ItemDropped(dst, 1)
+	topo.StageStopped(dst, context.Canceled)
+	return topo
+}
+
+func TestTopologyExport(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(topo *Topology, buf *bytes.Buffer) error
+		want  string
+	}{
+		{
+			name: "DOT",
+			write: func(topo *Topology, buf *bytes.Buffer) error {
+				return topo.WriteDOT(buf)
+			},
+			want: `digraph pipeline {
+  rankdir=LR;
+  node [shape=box];
+  s1 [label="Range #1\nrecv 0 / emit 3 / drop 0\ncompleted", style=dashed];
+  s2 [label="Map \"x\" #2\nrecv 2 / emit 1 / drop 1\nerrors 1\nstopped: context canceled", style=dashed, color=red];
+  s1 -> s2 [label="1/2"];
+}
+`,
+		},
+		{
+			name: "Mermaid",
+			write: func(topo *Topology, buf *bytes.Buffer) error {
+				return topo.WriteMermaid(buf)
+			},
+			want: `flowchart LR
+  s1["Range #1<br/>recv 0 / emit 3 / drop 0<br/>completed"]
+  s2["Map #quot;x#quot; #2<br/>recv 2 / emit 1 / drop 1<br/>errors 1<br/>stopped: context canceled"]
+  s1 -->|"1/2"| s2
+`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			if err := tt.write(twoStageTopology(), &buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopologyPipeline(t *testing.T) {
+	topo := NewTopology()
+	ctx := WithObserver(context.Background(), topo)
+	a, b := Tee(ctx, Range(ctx, 0, 4, 1))
+	receiveAll(t, Merge(ctx, Take(ctx, a, 4), b))
+
+	var snap TopologySnapshot
+	deadline := time.Now().Add(time.Second)
+	for {
+		snap = topo.Snapshot()
+		running := false
+		for _, n := range snap.Nodes {
+			running = running || n.Running
+		}
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stages are not stopped: %+v", snap.Nodes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// IDs relative to the first stage
+	base := snap.Nodes[0].ID
+	type node struct {
+		name              string
+		received, emitted uint64
+	}
+	gotNodes := []node{}
+	for _, n := range snap.Nodes {
+		gotNodes = append(gotNodes, node{n.Name, n.Received, n.Emitted})
+	}
+	wantNodes := []node{
+		{"Range", 0, 4},
+		{"Tee", 4, 4},
+		{"Take", 4, 4},
+		{"Merge", 8, 8},
+	}
+	if !reflect.DeepEqual(gotNodes, wantNodes) {
+		t.Errorf("nodes = %v, want %v", gotNodes, wantNodes)
+	}
+	gotEdges := [][2]uint64{}
+	for _, e := range snap.Edges {
+		gotEdges = append(gotEdges, [2]uint64{e.From - base, e.To - base})
+	}
+	wantEdges := [][2]uint64{{0, 1}, {1, 2}, {1, 3}, {2, 3}}
+	if !reflect.DeepEqual(gotEdges, wantEdges) {
+		t.Errorf("edges = %v, want %v", gotEdges, wantEdges)
+	}
+}
+
+func TestTopologyServeHTTP(t *testing.T) {
+	srv := httptest.NewServer(twoStageTopology())
+	defer srv.Close()
+	tests := []struct {
+		query           string
+		wantStatus      int
+		wantContentType string
+	}{
+		{query: "", wantStatus: http.StatusOK, wantContentType: "text/vnd.graphviz; charset=utf-8"},
+		{query: "?format=mermaid", wantStatus: http.StatusOK, wantContentType: "text/plain; charset=utf-8"},
+		{query: "?format=json", wantStatus: http.StatusOK, wantContentType: "application/json"},
+		{query: "?format=png", wantStatus: http.StatusBadRequest, wantContentType: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.wantStatus || resp.Header.Get("Content-Type") != tt.wantContentType {
+			t.Errorf("GET %q = (%v, %q), want (%v, %q)", tt.query, resp.StatusCode,
+				resp.Header.Get("Content-Type"), tt.wantStatus, tt.wantContentType)
+		}
+		if tt.query == "?format=json" {
+			var snap TopologySnapshot
+			if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+				t.Errorf("decode JSON: %v", err)
+			} else if len(snap.Nodes) != 2 || len(snap.Edges) != 1 {
+				t.Errorf("snapshot = %+v, want 2 nodes and 1 edge", snap)
+			}
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Options of Walk
+type WalkOptions struct {
+	// Glob patterns of entries to be sent.
+	// A pattern matches either the base name or the slash-separated path relative to root.
+	// All entries are sent if empty.
+	// Directories not matched are still walked.
+	Include []string
+
+	// Glob patterns of entries to be skipped.
+	// Directories matched are not walked.
+	Exclude []string
+
+	// Maximum depth to walk, where entries just under root have depth 1.
+	// Zero means unlimited.
+	MaxDepth int
+
+	// Walk into directories pointed by symbolic links.
+	// Each directory is walked only once even if links make a cycle.
+	FollowSymlinks bool
+
+	// Maximum number of directories read in parallel.
+	// Zero means runtime.NumCPU().
+	Concurrency int
+}
+
+// Entry sent by Walk
+type WalkEntry struct {
+	// Path of the entry, which is root joined with the relative path
+	Path string
+
+	// Slash-separated path relative to root
+	Rel string
+
+	// Depth of the entry, where entries just under root have depth 1
+	Depth int
+
+	fs.DirEntry
+}
+
+// Directory to be walked
+type walkJob struct {
+	dir   string
+	rel   string
+	depth int
+}
+
+// Report whether base name or rel matches any of patterns
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk sends entries of the file tree under root as they are discovered.
+//
+// Directories are read in parallel, so the order of entries is not defined.
+// Walk stops at the first error, which is sent to the error channel,
+// or when ctx is drained.
+// The error channel receives at most one error,
+// and is closed after the entry channel is closed.
+func Walk(ctx context.Context, root string, opts WalkOptions) (<-chan WalkEntry, <-chan error) {
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			entryChan := make(chan WalkEntry)
+			errChan := make(chan error, 1)
+			errChan <- err
+			close(entryChan)
+			close(errChan)
+			return entryChan, errChan
+		}
+	}
+
+	p := observe(ctx, "Walk")
+	drain := DrainSignal(ctx)
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	entryChan := make(chan WalkEntry)
+	errChan := make(chan error, 1)
+
+	var mu sync.Mutex
+	visited := map[string]bool{}
+	// report whether dir is walked first time
+	firstVisit := func(dir string) bool {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			resolved = dir
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if visited[resolved] {
+			return false
+		}
+		visited[resolved] = true
+		return true
+	}
+	fail := func(err error) {
+		p.Fail(err)
+		select {
+		case errChan <- err:
+		default:
+		}
+		cancel()
+	}
+
+	// Directories are passed from the dispatcher to a fixed number of workers,
+	// and directories found by workers are queued by the dispatcher,
+	// so that the number of goroutines is bounded by concurrency.
+	jobs := make(chan walkJob)
+	found := make(chan walkJob)
+	finished := make(chan struct{})
+
+	walkDir := func(j walkJob) {
+		entries, err := os.ReadDir(j.dir)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for _, e := range entries {
+			er := e.Name()
+			if j.rel != "" {
+				er = j.rel + "/" + e.Name()
+			}
+			if matchAny(opts.Exclude, er) {
+				continue
+			}
+			we := WalkEntry{
+				Path:     filepath.Join(j.dir, e.Name()),
+				Rel:      er,
+				Depth:    j.depth,
+				DirEntry: e,
+			}
+
+			isDir := e.IsDir()
+			if !isDir && opts.FollowSymlinks && e.Type()&fs.ModeSymlink != 0 {
+				if fi, err := os.Stat(we.Path); err == nil && fi.IsDir() {
+					isDir = true
+				}
+			}
+
+			if len(opts.Include) == 0 || matchAny(opts.Include, er) {
+				select {
+				case <-ctx.Done():
+					return
+				case <-drain:
+					return
+				case entryChan <- we:
+					p.Emitted(we)
+				}
+			}
+
+			if isDir && (opts.MaxDepth == 0 || j.depth < opts.MaxDepth) && firstVisit(we.Path) {
+				// the dispatcher receives it while this worker is active
+				found <- walkJob{dir: we.Path, rel: er, depth: j.depth + 1}
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				select {
+				case <-ctx.Done():
+				case <-drain:
+				default:
+					walkDir(j)
+				}
+				finished <- struct{}{}
+			}
+		}()
+	}
+
+	firstVisit(root)
+	go func() {
+		queue := []walkJob{{dir: root, rel: "", depth: 1}}
+		active := 0 // number of workers walking directory
+		// nil after stopped, so as not to be selected again
+		stop, stopDrain := ctx.Done(), drain
+		for len(queue) > 0 || active > 0 {
+			var next chan<- walkJob // nil if queue is empty
+			var head walkJob
+			if len(queue) > 0 {
+				next, head = jobs, queue[0]
+			}
+			select {
+			case next <- head:
+				queue = queue[1:]
+				active++
+			case j := <-found:
+				if stop != nil {
+					queue = append(queue, j)
+				}
+			case <-finished:
+				active--
+			case <-stop:
+				queue, stop, stopDrain = nil, nil, nil
+			case <-stopDrain:
+				queue, stop, stopDrain = nil, nil, nil
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		cancel()
+		p.Stopped()
+		close(entryChan)
+		close(errChan)
+	}()
+	return output(p, entryChan), errChan
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ctxpl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Make file tree for tests of Walk
+//
+//	root/
+//	  a.go
+//	  b.txt
+//	  sub/c.go
+//	  sub/deep/d.go
+//	  skip/e.go
+//	  link -> sub
+func makeWalkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range []string{"a.go", "b.txt", "sub/c.go", "sub/deep/d.go", "skip/e.go"} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "link")); err != nil {
+		t.Skip("symbolic link is not supported:", err)
+	}
+	return root
+}
+
+func TestWalk(t *testing.T) {
+	root := makeWalkTree(t)
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{
+			name: "all",
+			want: []string{"a.go", "b.txt", "link", "skip", "skip/e.go", "sub", "sub/c.go", "sub/deep", "sub/deep/d.go"},
+		},
+		{
+			name: "include",
+			opts: WalkOptions{Include: []string{"*.go"}},
+			want: []string{"a.go", "skip/e.go", "sub/c.go", "sub/deep/d.go"},
+		},
+		{
+			name: "include relative path",
+			opts: WalkOptions{Include: []string{"sub/*"}},
+			want: []string{"sub/c.go", "sub/deep"},
+		},
+		{
+			name: "exclude",
+			opts: WalkOptions{Exclude: []string{"skip", "*.txt"}},
+			want: []string{"a.go", "link", "sub", "sub/c.go", "sub/deep", "sub/deep/d.go"},
+		},
+		{
+			name: "max depth",
+			opts: WalkOptions{MaxDepth: 2, Exclude: []string{"skip"}},
+			want: []string{"a.go", "b.txt", "link", "sub", "sub/c.go", "sub/deep"},
+		},
+		{
+			name: "follow symbolic links",
+			opts: WalkOptions{FollowSymlinks: true, Include: []string{"*.go"}, Exclude: []string{"sub"}},
+			want: []string{"a.go", "link/c.go", "link/deep/d.go", "skip/e.go"},
+		},
+		{
+			name: "concurrency 1",
+			opts: WalkOptions{Concurrency: 1, Include: []string{"*.go"}},
+			want: []string{"a.go", "skip/e.go", "sub/c.go", "sub/deep/d.go"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			entries, err := drain(Walk(context.Background(), root, tt.opts))
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			got := []string{}
+			for _, e := range entries {
+				if want := filepath.Join(root, filepath.FromSlash(e.Rel)); e.Path != want {
+					t.Errorf("Walk() path = %v, want %v", e.Path, want)
+				}
+				got = append(got, e.Rel)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	tests := []struct {
+		name string
+		root string
+		opts WalkOptions
+	}{
+		{
+			name: "root not exist",
+			root: filepath.Join(t.TempDir(), "not-exist"),
+		},
+		{
+			name: "bad pattern",
+			root: t.TempDir(),
+			opts: WalkOptions{Include: []string{"["}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := drain(Walk(context.Background(), tt.root, tt.opts)); err == nil {
+				t.Errorf("Walk() doesn't error, want error")
+			}
+		})
+	}
+}
+
+func TestWalkCancel(t *testing.T) {
+	root := makeWalkTree(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	c, errc := Walk(ctx, root, WalkOptions{})
+	<-c
+	cancel()
+	for range c {
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Walk() error = %v, want nil", err)
+	}
+}
+
+func TestWalkBoundedGoroutines(t *testing.T) {
+	// root/dirNN/file for 100 directories
+	root := t.TempDir()
+	const dirs = 100
+	for i := 0; i < dirs; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%02d", i))
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const concurrency = 2
+	c, errc := Walk(ctx, root, WalkOptions{Concurrency: concurrency, Include: []string{"file"}})
+	// all directories are found while walks of them are blocked by the receiver
+	<-c
+	time.Sleep(scaledTime(10))
+	// workers, dispatcher, and slack for goroutines of the runtime
+	if got, limit := runtime.NumGoroutine()-before, concurrency+1+2; got > limit {
+		t.Errorf("Walk() runs %d goroutines, want at most %d", got, limit)
+	}
+	cancel()
+	for range c {
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Walk() error = %v, want nil", err)
+	}
+}
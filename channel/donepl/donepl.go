@@ -17,33 +17,48 @@
 // IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
-// TODO: Swap the relationship between donepl and ctxpl
+// Package donepl provides pipeline stages cancelled by a done channel.
+//
+// Stages of donepl are not observed. To trace stages stopped by a done channel,
+// use ctxpl with contexts of ezctx.WithDone and ctxpl.WithObserver,
+// whose stages report ezctx.ErrDoneClosed as the reason when done is closed.
 package donepl
 
 import (
 	"time"
 
-	"github.com/ezotaka/golib/channel/ctxpl"
-	"github.com/ezotaka/golib/ezctx"
+	"github.com/ezotaka/golib/channel/internal/pl"
 )
 
+// orClosed returns done, or closed channel if done is nil.
+//
+// Nil done is regarded as closed channel, as ezctx.WithDone does.
+func orClosed[D any](done <-chan D) <-chan D {
+	if done != nil {
+		return done
+	}
+	c := make(chan D)
+	close(c)
+	return c
+}
+
 // return channel which is closed when channel or done is closed
 func OrDone[D any, T any](
 	done <-chan D,
 	channel <-chan T,
 ) <-chan T {
-	return ctxpl.OrDone(ezctx.WithDone(done), channel)
+	return pl.OrDone(orClosed(done), nil, channel)
 }
 
 func Repeat[D any, T any](done <-chan D, values ...T) <-chan T {
-	return ctxpl.Repeat(ezctx.WithDone(done), values...)
+	return pl.Repeat(orClosed(done), nil, nil, values...)
 }
 
 func RepeatFunc[D any, T any](
 	done <-chan D,
 	fn func() T,
 ) <-chan T {
-	return ctxpl.RepeatFunc(ezctx.WithDone(done), fn)
+	return pl.RepeatFunc(orClosed(done), nil, nil, fn)
 }
 
 func Take[D any, T any](
@@ -51,7 +66,7 @@ func Take[D any, T any](
 	valueChan <-chan T,
 	num int,
 ) <-chan T {
-	return ctxpl.Take(ezctx.WithDone(done), valueChan, num)
+	return pl.Take(orClosed(done), nil, valueChan, num)
 }
 
 func Sleep[D any, T any](
@@ -59,7 +74,7 @@ func Sleep[D any, T any](
 	c <-chan T,
 	t time.Duration,
 ) <-chan T {
-	return ctxpl.Sleep(ezctx.WithDone(done), c, t)
+	return pl.Sleep(orClosed(done), nil, c, t)
 }
 
 // Split the channel into two channels
@@ -67,5 +82,13 @@ func Tee[D any, T any](
 	done <-chan D,
 	in <-chan T,
 ) (<-chan T, <-chan T) {
-	return ctxpl.Tee(ezctx.WithDone(done), in)
+	return pl.Tee(orClosed(done), nil, in)
+}
+
+// Merge channels into one channel, which is closed when all of channels are closed
+func Merge[D any, T any](
+	done <-chan D,
+	channels ...<-chan T,
+) <-chan T {
+	return pl.Merge(orClosed(done), nil, channels...)
 }
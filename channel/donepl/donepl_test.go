@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package donepl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezctx"
+)
+
+// takeViaCtx is the former implementation of Take,
+// which wraps done into context and delegates to ctxpl.
+// It is kept to compare performance in BenchmarkTake.
+func takeViaCtx[D any, T any](
+	done <-chan D,
+	valueChan <-chan T,
+	num int,
+) <-chan T {
+	ctx, cancel := ezctx.WithDone(context.Background(), done)
+	c := ctxpl.Take(ctx, valueChan, num)
+	if c == nil {
+		cancel()
+		return nil
+	}
+	valChan := make(chan T)
+	go func() {
+		defer close(valChan)
+		defer cancel()
+		for v := range ctxpl.OrDone(ctx, c) {
+			valChan <- v
+		}
+	}()
+	return valChan
+}
+
+func TestTake(t *testing.T) {
+	type args struct {
+		done      <-chan struct{}
+		valueChan <-chan int
+		num       int
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "take 2",
+			args: args{
+				done:      make(chan struct{}),
+				valueChan: conv.Chan(1, 2, 3),
+				num:       2,
+			},
+			want: 2,
+		},
+		{
+			name: "can't take from closed channel",
+			args: args{
+				done:      make(chan struct{}),
+				valueChan: conv.Chan(1, 2),
+				num:       3,
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := len(conv.Slice(Take(tt.args.done, tt.args.valueChan, tt.args.num))); got != tt.want {
+				t.Errorf("len(Take()) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilDone(t *testing.T) {
+	tests := []struct {
+		name string
+		// stage created with nil done
+		stage func() <-chan int
+		// max number of values sent before the channel is closed
+		maxLen int
+	}{
+		{
+			name:   "Repeat",
+			stage:  func() <-chan int { return Repeat[struct{}](nil, 1) },
+			maxLen: 0,
+		},
+		{
+			name:   "Take of Repeat",
+			stage:  func() <-chan int { return Take[struct{}](nil, Repeat[struct{}](nil, 1), 3) },
+			maxLen: 0,
+		},
+		{
+			// a value may be sent since select chooses randomly
+			name:   "RepeatFunc",
+			stage:  func() <-chan int { return RepeatFunc[struct{}](nil, func() int { return 1 }) },
+			maxLen: -1,
+		},
+		{
+			name: "Interval",
+			stage: func() <-chan int {
+				c := make(chan int)
+				go func() {
+					defer close(c)
+					for range Interval[struct{}](nil, time.Millisecond) {
+						c <- 1
+					}
+				}()
+				return c
+			},
+			maxLen: -1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := tt.stage()
+			got := 0
+			timeout := time.After(time.Second)
+			for {
+				select {
+				case _, ok := <-c:
+					if ok {
+						got++
+						continue
+					}
+				case <-timeout:
+					t.Fatalf("channel is not closed with nil done")
+				}
+				break
+			}
+			if tt.maxLen >= 0 && got > tt.maxLen {
+				t.Errorf("%s sent %d values, want at most %d", tt.name, got, tt.maxLen)
+			}
+		})
+	}
+}
+
+func BenchmarkTake(b *testing.B) {
+	b.Run("native", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			done := make(chan struct{})
+			for range Take(done, Repeat(done, 1), 10) {
+			}
+			close(done)
+		}
+	})
+	b.Run("via context", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			done := make(chan struct{})
+			for range takeViaCtx(done, Repeat(done, 1), 10) {
+			}
+			close(done)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package donepl
+
+import (
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Type constraint of numbers sent by Range
+type Number = pl.Number
+
+// return channel which sends the current time every d
+//
+// Ticks are dropped if the receiver is slow, like time.Ticker.
+// It panics if d is not positive.
+func Interval[D any](done <-chan D, d time.Duration) <-chan time.Time {
+	return pl.Interval(orClosed(done), nil, nil, d)
+}
+
+// return channel which sends the current time once after d, and is closed
+func Timer[D any](done <-chan D, d time.Duration) <-chan time.Time {
+	return pl.Timer(orClosed(done), nil, nil, d)
+}
+
+// return channel which sends numbers from start to end (exclusive) by step
+//
+// It stops early if adding step no longer advances the value,
+// by overflow of integers or by precision of floats.
+// It panics if step is zero.
+func Range[D any, N Number](done <-chan D, start, end, step N) <-chan N {
+	return pl.Range(orClosed(done), nil, nil, start, end, step)
+}
+
+// return channel which sends values generated by fn from seed
+//
+// fn returns the value to send, the next state,
+// and false when the sequence ends.
+func Unfold[D any, S any, T any](
+	done <-chan D,
+	seed S,
+	fn func(S) (T, S, bool),
+) <-chan T {
+	return pl.Unfold(orClosed(done), nil, nil, seed, fn)
+}
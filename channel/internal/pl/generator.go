@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pl
+
+import "time"
+
+// Type constraint of numbers
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// return channel which sends the current time every d
+//
+// Ticks are dropped if the receiver is slow, like time.Ticker.
+func Interval[D any](done <-chan D, drain <-chan struct{}, p Probe, d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		panic("d must be positive")
+	}
+	tickChan := make(chan time.Time)
+	go func() {
+		defer close(tickChan)
+		defer stopped(p)
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-drain:
+				return
+			case t := <-ticker.C:
+				select {
+				case <-done:
+					return
+				case <-drain:
+					return
+				case tickChan <- t:
+					emitted(p, t)
+				}
+			}
+		}
+	}()
+	return tickChan
+}
+
+// return channel which sends the current time once after d, and is closed
+func Timer[D any](done <-chan D, drain <-chan struct{}, p Probe, d time.Duration) <-chan time.Time {
+	timerChan := make(chan time.Time)
+	go func() {
+		defer close(timerChan)
+		defer stopped(p)
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-drain:
+		case t := <-timer.C:
+			select {
+			case <-done:
+			case <-drain:
+			case timerChan <- t:
+				emitted(p, t)
+			}
+		}
+	}()
+	return timerChan
+}
+
+// return channel which sends numbers from start to end (exclusive) by step
+func Range[D any, N Number](done <-chan D, drain <-chan struct{}, p Probe, start, end, step N) <-chan N {
+	if step == 0 {
+		panic("step must not be zero")
+	}
+	var zero N
+	rangeChan := make(chan N)
+	go func() {
+		defer close(rangeChan)
+		defer stopped(p)
+		for v := start; (step > zero && v < end) || (step < zero && v > end); v += step {
+			select {
+			case <-done:
+				return
+			case <-drain:
+				return
+			case rangeChan <- v:
+				emitted(p, v)
+			}
+			// stop before overflow, or when float step is lost in precision
+			if (step > zero && v+step <= v) || (step < zero && v+step >= v) {
+				return
+			}
+		}
+	}()
+	return rangeChan
+}
+
+// return channel which sends values generated by fn from seed
+//
+// fn returns the value to send, the next state,
+// and false when the sequence ends.
+func Unfold[D any, S any, T any](
+	done <-chan D,
+	drain <-chan struct{},
+	p Probe,
+	seed S,
+	fn func(S) (T, S, bool),
+) <-chan T {
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	valueChan := make(chan T)
+	go func() {
+		defer close(valueChan)
+		defer stopped(p)
+		state := seed
+		for {
+			select {
+			case <-done:
+				return
+			case <-drain:
+				return
+			default:
+			}
+			v, next, ok := fn(state)
+			if !ok {
+				return
+			}
+			// v is sent even if drained, since fn may consume external state
+			select {
+			case <-done:
+				dropped(p, v)
+				return
+			case valueChan <- v:
+				emitted(p, v)
+			}
+			state = next
+		}
+	}()
+	return valueChan
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package pl is the core of pipeline stages shared by ctxpl and donepl.
+//
+// Every stage runs on a raw done channel, so ctxpl passes ctx.Done()
+// and donepl passes its done channel as it is.
+// Every stage also reports items to Probe p, which may be nil.
+// Sources stop producing when drain is closed, while other stages
+// continue until their input is closed. Nil drain is never closed.
+package pl
+
+import (
+	"sync"
+	"time"
+)
+
+// return channel which is closed when channel or done is closed
+func OrDone[D any, T any](
+	done <-chan D,
+	p Probe,
+	channel <-chan T,
+) <-chan T {
+	valChan := make(chan T)
+	go func() {
+		defer close(valChan)
+		defer stopped(p)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-channel:
+				if !ok {
+					return
+				}
+				received(p, v)
+				select {
+				case valChan <- v:
+					emitted(p, v)
+				case <-done:
+					dropped(p, v)
+				}
+			}
+		}
+	}()
+	return valChan
+}
+
+func Repeat[D any, T any](done <-chan D, drain <-chan struct{}, p Probe, values ...T) <-chan T {
+	valuesChan := make(chan T)
+	select {
+	case <-done:
+		close(valuesChan)
+		stopped(p)
+	case <-drain:
+		close(valuesChan)
+		stopped(p)
+	default:
+		go func() {
+			defer close(valuesChan)
+			defer stopped(p)
+			if len(values) == 0 {
+				return
+			}
+			for {
+				for _, v := range values {
+					select {
+					case <-done:
+						return
+					case <-drain:
+						return
+					case valuesChan <- v:
+						emitted(p, v)
+					}
+				}
+			}
+		}()
+	}
+	return valuesChan
+}
+
+func RepeatFunc[D any, T any](
+	done <-chan D,
+	drain <-chan struct{},
+	p Probe,
+	fn func() T,
+) <-chan T {
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	valueChan := make(chan T)
+	go func() {
+		defer close(valueChan)
+		defer stopped(p)
+		for {
+			select {
+			case <-drain:
+				return
+			default:
+			}
+			v := fn()
+			// v is sent even if drained, since fn may consume external state
+			select {
+			case <-done:
+				dropped(p, v)
+				return
+			case valueChan <- v:
+				emitted(p, v)
+			}
+		}
+	}()
+	return valueChan
+}
+
+func Take[D any, T any](
+	done <-chan D,
+	p Probe,
+	valueChan <-chan T,
+	num int,
+) <-chan T {
+	if valueChan == nil {
+		stopped(p)
+		return nil
+	}
+	takeChan := make(chan T)
+	go func() {
+		defer close(takeChan)
+		defer stopped(p)
+		for i := 0; i < num; i++ {
+			select {
+			case <-done:
+				return
+			case v, ok := <-valueChan:
+				if !ok {
+					return
+				}
+				received(p, v)
+				select {
+				case <-done:
+					dropped(p, v)
+					return
+				case takeChan <- v:
+					emitted(p, v)
+				}
+			}
+		}
+	}()
+	return takeChan
+}
+
+func Sleep[D any, T any](
+	done <-chan D,
+	p Probe,
+	c <-chan T,
+	t time.Duration,
+) <-chan T {
+	if t == 0 {
+		// c is passed through, so p should not be given
+		return c
+	}
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		defer stopped(p)
+		in := OrDone(done, nil, c)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				received(p, v)
+				select {
+				case <-done:
+					dropped(p, v)
+				case <-time.After(t):
+					ch <- v
+					emitted(p, v)
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// Split the channel into two channels
+func Tee[D any, T any](
+	done <-chan D,
+	p Probe,
+	in <-chan T,
+) (<-chan T, <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		defer stopped(p)
+		for val := range OrDone(done, nil, in) {
+			received(p, val)
+			var out1, out2 = out1, out2
+			// Writes reliably to two channels
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+					dropped(p, val)
+					return
+				case out1 <- val:
+					out1 = nil
+				case out2 <- val:
+					out2 = nil
+				}
+			}
+			// emitted once when sent to both outputs
+			emitted(p, val)
+		}
+	}()
+	return out1, out2
+}
+
+// Merge channels into one channel, which is closed when all of channels are closed
+func Merge[D any, T any](
+	done <-chan D,
+	p Probe,
+	channels ...<-chan T,
+) <-chan T {
+	mergedChan := make(chan T)
+	var wg sync.WaitGroup
+	for _, c := range channels {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range OrDone(done, nil, c) {
+				received(p, v)
+				select {
+				case <-done:
+					dropped(p, v)
+					return
+				case mergedChan <- v:
+					emitted(p, v)
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(mergedChan)
+		defer stopped(p)
+		wg.Wait()
+	}()
+	return mergedChan
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pl
+
+// Probe observes items flowing through a stage.
+// Stages accept nil Probe, which observes nothing.
+type Probe interface {
+	// Item is received from input
+	Received(v any)
+	// Item is sent to output
+	Emitted(v any)
+	// Item is received but not sent because of cancellation
+	Dropped(v any)
+	// Stage is stopped and output is closed
+	Stopped()
+}
+
+func received[T any](p Probe, v T) {
+	if p != nil {
+		p.Received(v)
+	}
+}
+
+func emitted[T any](p Probe, v T) {
+	if p != nil {
+		p.Emitted(v)
+	}
+}
+
+func dropped[T any](p Probe, v T) {
+	if p != nil {
+		p.Dropped(v)
+	}
+}
+
+func stopped(p Probe) {
+	if p != nil {
+		p.Stopped()
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package pl
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stage of pipeline reported to Observer
+type Stage struct {
+	// Unique ID of the stage in the process, starting from 1
+	ID uint64 `json:"id"`
+
+	// Name of the stage function, e.g. "Take"
+	Name string `json:"name"`
+
+	// IDs of stages whose output is the input of this stage.
+	// Inputs not created by observed stages are not included.
+	Inputs []uint64 `json:"inputs"`
+}
+
+// Observer is called by stages to trace items flowing through pipeline.
+//
+// Methods are called from goroutines of stages,
+// so Observer must be safe for concurrent use and should return quickly.
+type Observer interface {
+	// Stage is created
+	StageStarted(s Stage)
+	// Stage is stopped and its output is closed.
+	// reason is nil if the stage is completed,
+	// the error if the stage failed,
+	// or the cause of cancellation if the stage is cancelled.
+	StageStopped(s Stage, reason error)
+	// Item is received from input of the stage
+	ItemReceived(s Stage, v any)
+	// Item is sent to output of the stage
+	ItemEmitted(s Stage, v any)
+	// Item is received but not sent because of cancellation
+	ItemDropped(s Stage, v any)
+	// Stage failed with error
+	Error(s Stage, err error)
+}
+
+// ID of the stage created last
+var lastStageID uint64
+
+// Tracer shared by stages reporting to the same Observer.
+// It links stages by their channels.
+type Tracer struct {
+	obs Observer
+	// called when channel c, which is an output of the stage from, is an input of s
+	connected func(s Stage, from uint64, c any)
+
+	mu      sync.Mutex
+	outputs map[any]uint64 // ID of stage by its output channel
+}
+
+// NewTracer returns Tracer reporting to obs.
+// connected is called when stages are linked, and may be nil.
+func NewTracer(obs Observer, connected func(s Stage, from uint64, c any)) *Tracer {
+	return &Tracer{
+		obs:       obs,
+		connected: connected,
+		outputs:   map[any]uint64{},
+	}
+}
+
+// StageProbe is Probe of a stage, which also reports start, stop and errors.
+// Nil *StageProbe observes nothing.
+type StageProbe struct {
+	t       *Tracer
+	stage   Stage
+	cause   func() error // cause of cancellation, or nil
+	outputs []any
+	stopped bool
+	err     error // error which stopped the stage
+}
+
+// Start observation of a stage named name whose input channels are inputs.
+//
+// cause returns the reason reported when the stage is stopped without failure.
+// It returns nil if t is nil.
+func (t *Tracer) Start(name string, cause func() error, inputs ...any) *StageProbe {
+	if t == nil {
+		return nil
+	}
+	s := Stage{ID: atomic.AddUint64(&lastStageID, 1), Name: name, Inputs: []uint64{}}
+	var channels []any // input channels of s.Inputs
+	t.mu.Lock()
+	for _, in := range inputs {
+		if id, ok := t.outputs[in]; ok {
+			s.Inputs = append(s.Inputs, id)
+			channels = append(channels, in)
+		}
+	}
+	t.mu.Unlock()
+	t.obs.StageStarted(s)
+	if t.connected != nil {
+		for i, c := range channels {
+			t.connected(s, s.Inputs[i], c)
+		}
+	}
+	return &StageProbe{t: t, stage: s, cause: cause}
+}
+
+// Output registers c as output of the stage of p, and returns c
+func Output[T any](p *StageProbe, c <-chan T) <-chan T {
+	if p == nil || c == nil {
+		return c
+	}
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	if p.stopped {
+		return c
+	}
+	p.t.outputs[c] = p.stage.ID
+	p.outputs = append(p.outputs, c)
+	return c
+}
+
+// Probe returns p as Probe, which is nil interface if p is nil
+func (p *StageProbe) Probe() Probe {
+	if p == nil {
+		return nil
+	}
+	return p
+}
+
+func (p *StageProbe) Received(v any) {
+	if p != nil {
+		p.t.obs.ItemReceived(p.stage, v)
+	}
+}
+
+func (p *StageProbe) Emitted(v any) {
+	if p != nil {
+		p.t.obs.ItemEmitted(p.stage, v)
+	}
+}
+
+func (p *StageProbe) Dropped(v any) {
+	if p != nil {
+		p.t.obs.ItemDropped(p.stage, v)
+	}
+}
+
+// Error reports err which does not stop the stage
+func (p *StageProbe) Error(err error) {
+	if p != nil {
+		p.t.obs.Error(p.stage, err)
+	}
+}
+
+// Fail reports err which stops the stage
+func (p *StageProbe) Fail(err error) {
+	if p == nil {
+		return
+	}
+	p.t.mu.Lock()
+	p.err = err
+	p.t.mu.Unlock()
+	p.t.obs.Error(p.stage, err)
+}
+
+func (p *StageProbe) Stopped() {
+	if p == nil {
+		return
+	}
+	p.t.mu.Lock()
+	p.stopped = true
+	for _, c := range p.outputs {
+		delete(p.t.outputs, c)
+	}
+	reason := p.err
+	p.t.mu.Unlock()
+	if reason == nil && p.cause != nil {
+		reason = p.cause()
+	}
+	p.t.obs.StageStopped(p.stage, reason)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package channel
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// Value labeled with the name of its source
+type Tagged[T any] struct {
+	Tag string
+	V   T
+}
+
+// Name of the output of Demux for values routed to unknown names
+const DefaultRoute = ""
+
+// Router of Demux
+type Router[T any] struct {
+	// Names of outputs other than DefaultRoute
+	Routes []string
+	// Route returns name of output for v.
+	// Values routed to names not in Routes are sent to DefaultRoute.
+	Route func(v T) string
+}
+
+// Mux merges channels into one channel labeling each value with its key in channels.
+//
+// Mux receives all channels with a single goroutine using reflect.Select.
+// The returned channel is closed when all channels are closed or ctx is done.
+// Nil channels are ignored.
+func Mux[T any](ctx context.Context, channels map[string]<-chan T) <-chan Tagged[T] {
+	tags := make([]string, 0, len(channels))
+	for tag, c := range channels {
+		if c != nil {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	cs := make([]<-chan T, len(tags))
+	for i, tag := range tags {
+		cs[i] = channels[tag]
+	}
+
+	muxChan := make(chan Tagged[T])
+	go func() {
+		defer close(muxChan)
+		cases := selectCases(ctx, cs)
+		for len(cases) > 1 {
+			chosen, recv, ok := reflect.Select(cases)
+			if chosen == 0 {
+				return
+			}
+			if !ok {
+				cases = append(cases[:chosen], cases[chosen+1:]...)
+				tags = append(tags[:chosen-1], tags[chosen:]...)
+				continue
+			}
+			// recv holds nil if T is an interface type and nil is sent
+			v, _ := recv.Interface().(T)
+			select {
+			case <-ctx.Done():
+				return
+			case muxChan <- Tagged[T]{tags[chosen-1], v}:
+			}
+		}
+	}()
+	return muxChan
+}
+
+// Demux routes values received from in to the outputs named by router.
+//
+// The returned map has the channels of router.Routes and DefaultRoute.
+// All of them are closed when in is closed or ctx is done.
+// A value is sent by the same goroutine, so all outputs must be received
+// for the others to proceed.
+func Demux[T any](ctx context.Context, in <-chan T, router Router[T]) map[string]<-chan T {
+	if router.Route == nil {
+		panic("router.Route must not be nil")
+	}
+	outs := map[string]chan T{DefaultRoute: make(chan T)}
+	for _, name := range router.Routes {
+		if _, ok := outs[name]; !ok {
+			outs[name] = make(chan T)
+		}
+	}
+	result := make(map[string]<-chan T, len(outs))
+	for name, c := range outs {
+		result[name] = c
+	}
+
+	go func() {
+		defer func() {
+			for _, c := range outs {
+				close(c)
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				out, ok := outs[router.Route(v)]
+				if !ok {
+					out = outs[DefaultRoute]
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case out <- v:
+				}
+			}
+		}
+	}()
+	return result
+}
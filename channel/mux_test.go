@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package channel
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/conv"
+)
+
+func TestMux(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels map[string]<-chan int
+		// values of each tag in received order
+		want map[string][]int
+	}{
+		{
+			name: "tagged by source",
+			channels: map[string]<-chan int{
+				"a": conv.Chan(1, 2, 3),
+				"b": conv.Chan(10, 20),
+				"c": conv.Chan[int](),
+			},
+			want: map[string][]int{
+				"a": {1, 2, 3},
+				"b": {10, 20},
+			},
+		},
+		{
+			name: "nil channel is ignored",
+			channels: map[string]<-chan int{
+				"a": conv.Chan(1),
+				"b": nil,
+			},
+			want: map[string][]int{
+				"a": {1},
+			},
+		},
+		{
+			name:     "no channels",
+			channels: nil,
+			want:     map[string][]int{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := map[string][]int{}
+			for v := range Mux(context.Background(), tt.channels) {
+				got[v.Tag] = append(got[v.Tag], v.V)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Mux() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMuxCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan int)
+	out := Mux(ctx, map[string]<-chan int{"a": c})
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Errorf("Mux() sent value after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Mux() is not closed after cancel")
+	}
+}
+
+func TestDemux(t *testing.T) {
+	// route by prefix before ":"
+	route := func(v string) string {
+		return strings.SplitN(v, ":", 2)[0]
+	}
+	tests := []struct {
+		name   string
+		in     []string
+		routes []string
+		want   map[string][]string
+	}{
+		{
+			name:   "routed by name",
+			in:     []string{"a:1", "b:1", "a:2", "x:1", "b:2", "y:1"},
+			routes: []string{"a", "b", "c"},
+			want: map[string][]string{
+				"a":          {"a:1", "a:2"},
+				"b":          {"b:1", "b:2"},
+				"c":          nil,
+				DefaultRoute: {"x:1", "y:1"},
+			},
+		},
+		{
+			name:   "default route only",
+			in:     []string{"a:1", "b:1"},
+			routes: nil,
+			want: map[string][]string{
+				DefaultRoute: {"a:1", "b:1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			outs := Demux(context.Background(), conv.Chan(tt.in...), Router[string]{
+				Routes: tt.routes,
+				Route:  route,
+			})
+			if len(outs) != len(tt.want) {
+				t.Fatalf("Demux() returned %d outputs, want %d", len(outs), len(tt.want))
+			}
+			var (
+				mu  sync.Mutex
+				wg  sync.WaitGroup
+				got = map[string][]string{}
+			)
+			for name, c := range outs {
+				name, c := name, c
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for v := range c {
+						mu.Lock()
+						got[name] = append(got[name], v)
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			for name, want := range tt.want {
+				if !reflect.DeepEqual(got[name], want) {
+					t.Errorf("Demux()[%q] = %v, want %v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDemuxCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	outs := Demux(ctx, make(chan int), Router[int]{
+		Routes: []string{"a"},
+		Route:  func(int) string { return "a" },
+	})
+	cancel()
+	for name, c := range outs {
+		select {
+		case _, ok := <-c:
+			if ok {
+				t.Errorf("Demux()[%q] sent value after cancel", name)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Demux()[%q] is not closed after cancel", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package netpl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+)
+
+// Deadline in the past, which interrupts blocking Read and Write of net.Conn
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Read sends messages read from conn split by f.
+//
+// A blocking read is interrupted when ctx is done or drained,
+// and the read deadline of conn is reset after that.
+// The error channel receives at most one error other than io.EOF,
+// and is closed after the message channel is closed.
+func Read(ctx context.Context, conn net.Conn, f Framer) (<-chan []byte, <-chan error) {
+	msgChan := make(chan []byte)
+	errChan := make(chan error, 1)
+	br := bufio.NewReader(conn)
+	stop := watch(ctx, ctxpl.DrainSignal(ctx), func() {
+		conn.SetReadDeadline(aLongTimeAgo)
+	})
+	go func() {
+		defer close(errChan)
+		defer close(msgChan)
+		defer func() {
+			if stop() {
+				conn.SetReadDeadline(time.Time{})
+			}
+		}()
+		for {
+			msg, err := f.ReadFrame(br)
+			if err != nil {
+				// error caused by the deadline set in watch is not reported
+				if !stop() && !errors.Is(err, io.EOF) {
+					errChan <- &ConnError{Addr: conn.RemoteAddr(), Err: err}
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case msgChan <- msg:
+			}
+		}
+	}()
+	return msgChan, errChan
+}
+
+// Write writes messages received from in to conn joined by f.
+//
+// Buffered data is flushed whenever in has no message ready, and at the end.
+// This function is blocked until in is closed or ctx is done.
+// It returns ctx.Err() if ctx is done, interrupting a blocking write.
+// Other errors are returned as *ConnError.
+func Write(ctx context.Context, conn net.Conn, f Framer, in <-chan []byte) error {
+	bw := bufio.NewWriter(conn)
+	stop := watch(ctx, nil, func() {
+		conn.SetWriteDeadline(aLongTimeAgo)
+	})
+	err := writeFrames(ctx, bw, f, in)
+	if stop() {
+		conn.SetWriteDeadline(time.Time{})
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return &ConnError{Addr: conn.RemoteAddr(), Err: err}
+	}
+	return nil
+}
+
+// Loop of Write
+func writeFrames(ctx context.Context, bw *bufio.Writer, f Framer, in <-chan []byte) error {
+	for {
+		var msg []byte
+		var ok bool
+		select {
+		case msg, ok = <-in:
+		default:
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case msg, ok = <-in:
+			}
+		}
+		if !ok {
+			return bw.Flush()
+		}
+		if err := f.WriteFrame(bw, msg); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
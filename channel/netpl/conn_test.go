@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package netpl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/conv"
+)
+
+// Connected pair of TCP connections over loopback
+func loopback(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	if server == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// Receive all messages and the error, or fail after timeout
+func receiveMessages(t *testing.T, c <-chan []byte, errc <-chan error) ([]string, error) {
+	t.Helper()
+	got := []string{}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m, ok := <-c:
+			if !ok {
+				return got, <-errc
+			}
+			got = append(got, string(m))
+		case <-timeout:
+			t.Fatalf("channel is not closed, received %v", got)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer Framer
+		msgs   []string
+	}{
+		{
+			name:   "newline",
+			framer: Newline,
+			msgs:   []string{"hello", "", "world"},
+		},
+		{
+			name:   "length prefixed",
+			framer: LengthPrefixed(0),
+			msgs:   []string{"hello", "", "line\nbreak"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			client, server := loopback(t)
+			ctx := context.Background()
+			in := make(chan []byte)
+			go func() {
+				defer close(in)
+				for _, m := range tt.msgs {
+					in <- []byte(m)
+				}
+			}()
+			go func() {
+				if err := Write(ctx, client, tt.framer, in); err != nil {
+					t.Errorf("Write() error = %v", err)
+				}
+				client.Close()
+			}()
+			c, errc := Read(ctx, server, tt.framer)
+			got, err := receiveMessages(t, c, errc)
+			if err != nil {
+				t.Errorf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.msgs) {
+				t.Errorf("Read() = %q, want %q", got, tt.msgs)
+			}
+		})
+	}
+}
+
+func TestReadError(t *testing.T) {
+	client, server := loopback(t)
+	client.Write([]byte{0, 0, 0, 9, 'a'})
+	client.Close()
+	c, errc := Read(context.Background(), server, LengthPrefixed(0))
+	_, err := receiveMessages(t, c, errc)
+	var connErr *ConnError
+	if !errors.As(err, &connErr) || connErr.Addr.String() != client.LocalAddr().String() {
+		t.Errorf("Read() error = %v, want *ConnError of %v", err, client.LocalAddr())
+	}
+}
+
+func TestReadCancel(t *testing.T) {
+	client, server := loopback(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	c, errc := Read(ctx, server, Newline)
+	cancel()
+	if got, err := receiveMessages(t, c, errc); len(got) != 0 || err != nil {
+		t.Errorf("Read() = (%v, %v), want nothing", got, err)
+	}
+
+	// conn is still usable after cancel
+	go Write(context.Background(), client, Newline, conv.Chan([]byte("after")))
+	c, errc = Read(context.Background(), server, Newline)
+	select {
+	case m := <-c:
+		if string(m) != "after" {
+			t.Errorf("Read() = %q, want %q", m, "after")
+		}
+	case err := <-errc:
+		t.Errorf("Read() error = %v", err)
+	case <-time.After(time.Second):
+		t.Errorf("Read() timeout")
+	}
+}
+
+func TestWriteCancel(t *testing.T) {
+	client, _ := loopback(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	// in is never closed
+	in := make(chan []byte)
+	errc := make(chan error)
+	go func() {
+		errc <- Write(ctx, client, Newline, in)
+	}()
+	in <- []byte("hello")
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Write() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Write() is not returned after cancel")
+	}
+}
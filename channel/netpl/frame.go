@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package netpl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Default max size of a message of LengthPrefixed
+const defaultMaxFrameSize = 1 << 20
+
+// ErrFrameTooLarge is returned when a message exceeds the max size of Framer
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// ErrNewlineInMessage is returned when a message written by Newline has newline
+var ErrNewlineInMessage = errors.New("message has newline")
+
+// Framer splits a byte stream into messages
+type Framer interface {
+	// ReadFrame reads a message from r.
+	// It returns io.EOF only if r ends at the boundary of messages.
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	// WriteFrame writes msg to w
+	WriteFrame(w *bufio.Writer, msg []byte) error
+}
+
+// Newline is Framer of newline-delimited messages.
+//
+// Messages are read without line endings "\n" or "\r\n".
+// The last line without a line ending is also a message.
+var Newline Framer = newlineFramer{}
+
+type newlineFramer struct{}
+
+func (newlineFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+func (newlineFramer) WriteFrame(w *bufio.Writer, msg []byte) error {
+	if bytes.IndexByte(msg, '\n') >= 0 {
+		return ErrNewlineInMessage
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// LengthPrefixed returns Framer of messages prefixed by 4-byte big-endian length.
+//
+// Messages larger than maxSize cause ErrFrameTooLarge. Zero maxSize means 1 MiB.
+func LengthPrefixed(maxSize int) Framer {
+	if maxSize <= 0 {
+		maxSize = defaultMaxFrameSize
+	}
+	return lengthFramer{maxSize: maxSize}
+}
+
+type lengthFramer struct {
+	maxSize int
+}
+
+func (f lengthFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(f.maxSize) {
+		return nil, ErrFrameTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (f lengthFramer) WriteFrame(w *bufio.Writer, msg []byte) error {
+	if len(msg) > f.maxSize {
+		return ErrFrameTooLarge
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package netpl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFramer(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer Framer
+		msgs   [][]byte
+	}{
+		{
+			name:   "newline",
+			framer: Newline,
+			msgs:   [][]byte{[]byte("hello"), {}, []byte("world")},
+		},
+		{
+			name:   "length prefixed",
+			framer: LengthPrefixed(0),
+			msgs:   [][]byte{[]byte("hello"), {}, []byte("line\nbreak"), {0, 1, 2}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			buf := &bytes.Buffer{}
+			bw := bufio.NewWriter(buf)
+			for _, m := range tt.msgs {
+				if err := tt.framer.WriteFrame(bw, m); err != nil {
+					t.Fatalf("WriteFrame() error = %v", err)
+				}
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(buf)
+			got := [][]byte{}
+			for {
+				m, err := tt.framer.ReadFrame(br)
+				if errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Fatalf("ReadFrame() error = %v", err)
+				}
+				got = append(got, m)
+			}
+			if !reflect.DeepEqual(got, tt.msgs) {
+				t.Errorf("ReadFrame() = %q, want %q", got, tt.msgs)
+			}
+		})
+	}
+}
+
+func TestFramerRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		framer  Framer
+		input   []byte
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name:   "CRLF and last line without newline",
+			framer: Newline,
+			input:  []byte("a\r\nb\nc"),
+			want:   [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+		},
+		{
+			name:    "too large",
+			framer:  LengthPrefixed(3),
+			input:   []byte{0, 0, 0, 4, 'a', 'b', 'c', 'd'},
+			want:    [][]byte{},
+			wantErr: ErrFrameTooLarge,
+		},
+		{
+			name:    "truncated header",
+			framer:  LengthPrefixed(0),
+			input:   []byte{0, 0, 0, 1, 'a', 0, 0},
+			want:    [][]byte{[]byte("a")},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "truncated body",
+			framer:  LengthPrefixed(0),
+			input:   []byte{0, 0, 0, 3, 'a'},
+			want:    [][]byte{},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			br := bufio.NewReader(bytes.NewReader(tt.input))
+			got := [][]byte{}
+			var err error
+			for {
+				var m []byte
+				if m, err = tt.framer.ReadFrame(br); err != nil {
+					break
+				}
+				got = append(got, m)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadFrame() = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr == nil {
+				tt.wantErr = io.EOF
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadFrame() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFramerWriteError(t *testing.T) {
+	tests := []struct {
+		name    string
+		framer  Framer
+		msg     []byte
+		wantErr error
+	}{
+		{
+			name:    "newline in message",
+			framer:  Newline,
+			msg:     []byte("a\nb"),
+			wantErr: ErrNewlineInMessage,
+		},
+		{
+			name:    "too large",
+			framer:  LengthPrefixed(3),
+			msg:     []byte("abcd"),
+			wantErr: ErrFrameTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			bw := bufio.NewWriter(io.Discard)
+			if err := tt.framer.WriteFrame(bw, tt.msg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("WriteFrame() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package netpl provides pipeline stages over network connections.
+//
+// Listeners are turned into channels of connections, and connections into
+// channels of messages split by Framer. All of them are shut down by ctx,
+// and sources stop by the drain of ctxpl.WithDrain.
+package netpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+)
+
+// ConnError is an error occurred on a connection
+type ConnError struct {
+	// Remote address of the connection
+	Addr net.Addr
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Addr, e.Err)
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// Call interrupt once when ctx is done or drain is closed, until the returned stop is called.
+//
+// stop waits for interrupt to finish, and returns whether interrupt is called.
+func watch(ctx context.Context, drain <-chan struct{}, interrupt func()) (stop func() bool) {
+	stopChan := make(chan struct{})
+	result := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drain:
+		case <-stopChan:
+			result <- false
+			return
+		}
+		interrupt()
+		result <- true
+	}()
+	var once sync.Once
+	var interrupted bool
+	return func() bool {
+		once.Do(func() {
+			close(stopChan)
+			interrupted = <-result
+		})
+		return interrupted
+	}
+}
+
+// Accept sends connections accepted by l.
+//
+// l is closed when ctx is done or drained, and the returned channel is closed
+// after that. The error channel receives at most one error of l.Accept,
+// and is closed after the connection channel is closed.
+// Connections not received are closed.
+func Accept(ctx context.Context, l net.Listener) (<-chan net.Conn, <-chan error) {
+	connChan := make(chan net.Conn)
+	errChan := make(chan error, 1)
+	stop := watch(ctx, ctxpl.DrainSignal(ctx), func() {
+		l.Close()
+	})
+	go func() {
+		defer close(errChan)
+		defer close(connChan)
+		defer func() {
+			if !stop() {
+				l.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				// error caused by closing l in watch is not reported
+				if !stop() && !errors.Is(err, net.ErrClosed) {
+					errChan <- err
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case connChan <- conn:
+			}
+		}
+	}()
+	return connChan, errChan
+}
+
+// Serve calls handle for each connection accepted by l in a new goroutine.
+//
+// The connection is closed after handle returns.
+// Errors returned by handle are sent as *ConnError, and an error of l.Accept
+// is sent as it is. Errors are dropped if they are not received until ctx is done.
+// The returned channel is closed after l is closed and all handle return.
+func Serve(
+	ctx context.Context,
+	l net.Listener,
+	handle func(context.Context, net.Conn) error,
+) <-chan error {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	errChan := make(chan error)
+	report := func(err error) {
+		select {
+		case <-ctx.Done():
+		case errChan <- err:
+		}
+	}
+	conns, acceptErr := Accept(ctx, l)
+	go func() {
+		defer close(errChan)
+		var wg sync.WaitGroup
+		for conn := range conns {
+			conn := conn
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := handle(ctx, conn)
+				conn.Close()
+				if err != nil {
+					report(&ConnError{Addr: conn.RemoteAddr(), Err: err})
+				}
+			}()
+		}
+		if err := <-acceptErr; err != nil {
+			report(err)
+		}
+		wg.Wait()
+	}()
+	return errChan
+}
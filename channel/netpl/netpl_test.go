@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package netpl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+	"github.com/ezotaka/golib/conv"
+)
+
+// Listener of network over loopback
+func listen(t *testing.T, network string) net.Listener {
+	t.Helper()
+	addr := "127.0.0.1:0"
+	if network == "unix" {
+		addr = filepath.Join(t.TempDir(), "netpl.sock")
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Skipf("%s is not available: %v", network, err)
+	}
+	return l
+}
+
+// Send msgs to addr and return the response lines
+func request(t *testing.T, l net.Listener, msgs ...string) []string {
+	t.Helper()
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	in := make(chan []byte, len(msgs))
+	for _, m := range msgs {
+		in <- []byte(m)
+	}
+	close(in)
+	if err := Write(context.Background(), conn, Newline, in); err != nil {
+		t.Fatal(err)
+	}
+	c, errc := Read(context.Background(), conn, Newline)
+	got, err := receiveMessages(t, c, errc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestServe(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+			l := listen(t, network)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// echo messages until "quit"
+			errc := Serve(ctx, l, func(ctx context.Context, conn net.Conn) error {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+				msgs, _ := Read(ctx, conn, Newline)
+				out := make(chan []byte)
+				go func() {
+					defer close(out)
+					for m := range msgs {
+						if string(m) == "quit" {
+							return
+						}
+						out <- m
+					}
+				}()
+				return Write(ctx, conn, Newline, out)
+			})
+			if got, want := request(t, l, "a", "b", "quit"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("response = %v, want %v", got, want)
+			}
+			cancel()
+			for err := range errc {
+				t.Errorf("Serve() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestServeConnError(t *testing.T) {
+	l := listen(t, "tcp")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errFail := errors.New("fail")
+	errc := Serve(ctx, l, func(ctx context.Context, conn net.Conn) error {
+		return errFail
+	})
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case err := <-errc:
+		var connErr *ConnError
+		if !errors.As(err, &connErr) || !errors.Is(err, errFail) {
+			t.Errorf("Serve() error = %v, want *ConnError of %v", err, errFail)
+		} else if connErr.Addr.String() != conn.LocalAddr().String() {
+			t.Errorf("ConnError.Addr = %v, want %v", connErr.Addr, conn.LocalAddr())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Serve() reports no error")
+	}
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop accepting by ctx
+		stop func(cancel context.CancelFunc, drain ctxpl.DrainFunc)
+	}{
+		{
+			name: "cancelled by context",
+			stop: func(cancel context.CancelFunc, _ ctxpl.DrainFunc) { cancel() },
+		},
+		{
+			name: "drained",
+			stop: func(_ context.CancelFunc, drain ctxpl.DrainFunc) { drain(0) },
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			l := listen(t, "tcp")
+			ctx, drain, cancel := ctxpl.WithDrain(context.Background())
+			defer cancel()
+			conns, errc := Accept(ctx, l)
+
+			client, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			conn := <-conns
+			if conn.RemoteAddr().String() != client.LocalAddr().String() {
+				t.Errorf("Accept() = %v, want %v", conn.RemoteAddr(), client.LocalAddr())
+			}
+			conn.Close()
+
+			tt.stop(cancel, drain)
+			for range conv.Slice(conns) {
+				t.Errorf("Accept() sent connection after stop")
+			}
+			if err := <-errc; err != nil {
+				t.Errorf("Accept() error = %v", err)
+			}
+			if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+				t.Errorf("listener is not closed")
+			}
+		})
+	}
+}
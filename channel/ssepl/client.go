@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ssepl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+)
+
+// Default value of SubscribeOptions
+const defaultRetry = 3 * time.Second
+
+// Options of Subscribe
+type SubscribeOptions struct {
+	// HTTP client, http.DefaultClient if nil
+	Client *http.Client
+
+	// Last-Event-ID of the first request
+	LastEventID string
+
+	// Time to wait before reconnection, unless the server advises it.
+	// Zero means 3 sec.
+	Retry time.Duration
+}
+
+// Read sends events read from event stream r.
+//
+// A blocking Read of r is not interrupted by ctx,
+// so r should be closed by the caller, like the body of a request with ctx.
+// The error channel receives at most one error other than io.EOF,
+// and is closed after the event channel is closed.
+func Read(ctx context.Context, r io.Reader) (<-chan Event, <-chan error) {
+	eventChan := make(chan Event)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		defer close(eventChan)
+		if err := readEvents(ctx, &eventParser{r: bufio.NewReader(r)}, eventChan); err != nil {
+			errChan <- err
+		}
+	}()
+	return eventChan, errChan
+}
+
+// Send events parsed by p until the end of stream, ctx is done or drained.
+func readEvents(ctx context.Context, p *eventParser, eventChan chan<- Event) error {
+	drain := ctxpl.DrainSignal(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-drain:
+			return nil
+		default:
+		}
+		ev, err := p.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				// the body is closed by ctx
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case eventChan <- ev:
+		}
+	}
+}
+
+// Subscribe sends events streamed from url.
+//
+// When the stream ends, or the connection fails by network error or
+// temporary status (429, 502, 503 or 504), it reconnects with Last-Event-ID
+// after the reconnection time, like EventSource.
+// It finishes without error when the server responds 204 No Content.
+// The error channel receives at most one error of invalid request or
+// other response status, and is closed after the event channel is closed.
+func Subscribe(ctx context.Context, url string, opts SubscribeOptions) (<-chan Event, <-chan error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Retry <= 0 {
+		opts.Retry = defaultRetry
+	}
+	eventChan := make(chan Event)
+	errChan := make(chan error, 1)
+	drain := ctxpl.DrainSignal(ctx)
+	go func() {
+		defer close(errChan)
+		defer close(eventChan)
+		p := &eventParser{lastID: opts.LastEventID}
+		for {
+			done, err := subscribeOnce(ctx, url, opts.Client, p, eventChan)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if done {
+				return
+			}
+			retry := p.retry
+			if retry <= 0 {
+				retry = opts.Retry
+			}
+			timer := time.NewTimer(retry)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-drain:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+	return eventChan, errChan
+}
+
+// Connect to url once, and send events until the stream ends.
+//
+// It returns true if no more reconnection is needed.
+func subscribeOnce(
+	ctx context.Context,
+	url string,
+	client *http.Client,
+	p *eventParser,
+	eventChan chan<- Event,
+) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if p.lastID != "" {
+		req.Header.Set("Last-Event-ID", p.lastID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// network error is retried, e.g. while the server restarts
+		return ctx.Err() != nil, nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ctx.Err() != nil, nil
+	default:
+		return true, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	p.r = bufio.NewReader(resp.Body)
+	// the stream is reconnected even if it is broken
+	readEvents(ctx, p, eventChan)
+	select {
+	case <-ctx.Done():
+		return true, nil
+	case <-ctxpl.DrainSignal(ctx):
+		return true, nil
+	default:
+		return false, nil
+	}
+}
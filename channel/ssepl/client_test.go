@@ -0,0 +1,214 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ssepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receive all events and the error from Subscribe, or fail after timeout
+func receiveAll(t *testing.T, c <-chan Event, errc <-chan error) ([]Event, error) {
+	t.Helper()
+	got := []Event{}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				return got, <-errc
+			}
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("channel is not closed, received %v", got)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	c, errc := Read(context.Background(), strings.NewReader("id: 1\ndata: a\n\ndata: b\n\n"))
+	got, err := receiveAll(t, c, errc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	in := make(chan int, 3)
+	in <- 1
+	in <- 2
+	in <- 3
+	close(in)
+	srv := httptest.NewServer(NewHandler(context.Background(), in, HandlerOptions[int]{}))
+	defer srv.Close()
+
+	// reconnect after the stream ends, and get 204
+	c, errc := Subscribe(context.Background(), srv.URL, SubscribeOptions{
+		LastEventID: "1",
+		Retry:       time.Millisecond,
+	})
+	got, err := receiveAll(t, c, errc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{{ID: "2", Data: "2"}, {ID: "3", Data: "3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscribe() = %v, want %v", got, want)
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		lastIDs []string
+	)
+	// each connection sends an event, and the third one responds 204
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastIDs)
+		mu.Unlock()
+		if n == 3 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "retry: 1\nid: %d\ndata: %d\n\n", n, n)
+	}))
+	defer srv.Close()
+
+	c, errc := Subscribe(context.Background(), srv.URL, SubscribeOptions{})
+	got, err := receiveAll(t, c, errc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Data != "1" || got[1].Data != "2" {
+		t.Errorf("Subscribe() = %v, want events 1 and 2", got)
+	}
+	if want := []string{"", "1", "2"}; !reflect.DeepEqual(lastIDs, want) {
+		t.Errorf("Last-Event-ID = %q, want %q", lastIDs, want)
+	}
+}
+
+// RoundTripper which fails the first n requests
+type failingTransport struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (tr *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr.mu.Lock()
+	fail := tr.n > 0
+	tr.n--
+	tr.mu.Unlock()
+	if fail {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSubscribeRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// status of the first 2 responses
+		status int
+		// number of requests failed by network error
+		failures int
+	}{
+		{name: "network error", status: http.StatusOK, failures: 2},
+		{name: "service unavailable", status: http.StatusServiceUnavailable},
+		{name: "too many requests", status: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu       sync.Mutex
+				requests int
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				n := requests
+				mu.Unlock()
+				switch {
+				case n <= 2 && tt.status != http.StatusOK:
+					w.WriteHeader(tt.status)
+				case r.Header.Get("Last-Event-ID") == "":
+					w.Header().Set("Content-Type", "text/event-stream")
+					fmt.Fprint(w, "id: 1\ndata: 1\n\n")
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer srv.Close()
+
+			c, errc := Subscribe(context.Background(), srv.URL, SubscribeOptions{
+				Client: &http.Client{Transport: &failingTransport{n: tt.failures}},
+				Retry:  time.Millisecond,
+			})
+			got, err := receiveAll(t, c, errc)
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v, want nil", err)
+			}
+			if want := []Event{{ID: "1", Data: "1"}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Subscribe() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSubscribeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c, errc := Subscribe(context.Background(), srv.URL, SubscribeOptions{})
+	if _, err := receiveAll(t, c, errc); err == nil {
+		t.Errorf("Subscribe() error = nil, want error")
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewHandler(ctx, make(chan int), HandlerOptions[int]{})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c, errc := Subscribe(ctx, srv.URL, SubscribeOptions{})
+	cancel()
+	if got, err := receiveAll(t, c, errc); len(got) != 0 || err != nil {
+		t.Errorf("Subscribe() = (%v, %v), want nothing", got, err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package ssepl bridges channels and HTTP clients by Server-Sent Events.
+//
+// Handler streams values of a channel to clients, and Read and Subscribe
+// turn an event stream into a source channel.
+package ssepl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event of Server-Sent Events
+type Event struct {
+	// Event ID, which is sent as Last-Event-ID by reconnecting client
+	ID string
+	// Event type, "message" if empty
+	Event string
+	// Data, which may have multiple lines
+	Data string
+	// Reconnection time advised by server.
+	// Read sets the last one in the stream so far, zero if not given.
+	Retry time.Duration
+}
+
+// Write ev in the format of event stream
+func writeEvent(w io.Writer, ev Event) error {
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", ev.ID)
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", ev.Event)
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Parser of event stream
+type eventParser struct {
+	r *bufio.Reader
+	// ID of the last event and reconnection time, which are kept for following events
+	lastID string
+	retry  time.Duration
+}
+
+// Read the next event, or io.EOF at the end of stream.
+//
+// An event not terminated by an empty line is discarded.
+func (p *eventParser) next() (Event, error) {
+	var (
+		ev      Event
+		data    strings.Builder
+		hasData bool
+	)
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			// incomplete event at the end is discarded
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if !hasData {
+				ev = Event{}
+				continue
+			}
+			ev.ID = p.lastID
+			ev.Retry = p.retry
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			return ev, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, which is used for heartbeat
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "event":
+			ev.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				p.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
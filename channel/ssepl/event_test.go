@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ssepl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parse all events of stream
+func parseAll(stream string) ([]Event, error) {
+	p := &eventParser{r: bufio.NewReader(strings.NewReader(stream))}
+	events := []Event{}
+	for {
+		ev, err := p.next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestEventParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			name:   "data",
+			stream: "data: a\n\ndata:b\n\n",
+			want:   []Event{{Data: "a"}, {Data: "b"}},
+		},
+		{
+			name:   "multiple lines with CRLF",
+			stream: "data: a\r\ndata: b\r\n\r\n",
+			want:   []Event{{Data: "a\nb"}},
+		},
+		{
+			name:   "fields",
+			stream: "id: 1\nevent: update\nretry: 1500\ndata: a\n\n",
+			want:   []Event{{ID: "1", Event: "update", Data: "a", Retry: 1500 * time.Millisecond}},
+		},
+		{
+			name:   "ID and retry are kept",
+			stream: "id: 1\nretry: 10\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			want: []Event{
+				{ID: "1", Data: "a", Retry: 10 * time.Millisecond},
+				{ID: "1", Data: "b", Retry: 10 * time.Millisecond},
+				{ID: "", Data: "c", Retry: 10 * time.Millisecond},
+			},
+		},
+		{
+			name:   "comments and events without data are ignored",
+			stream: ": heartbeat\n\nevent: x\n\ndata: a\nunknown: b\n\n",
+			want:   []Event{{Data: "a"}},
+		},
+		{
+			name:   "incomplete event is discarded",
+			stream: "data: a\n\ndata: b\n",
+			want:   []Event{{Data: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAll(tt.stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("next() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	events := []Event{
+		{Data: "a"},
+		{ID: "1", Event: "update", Data: "multi\nline", Retry: time.Second},
+		{ID: "2", Data: ""},
+	}
+	var buf bytes.Buffer
+	for _, ev := range events {
+		if err := writeEvent(&buf, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := parseAll(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// retry is kept by parser
+	want := []Event{
+		{Data: "a"},
+		{ID: "1", Event: "update", Data: "multi\nline", Retry: time.Second},
+		{ID: "2", Data: "", Retry: time.Second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed events = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ssepl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ezotaka/golib/channel/internal/pl"
+)
+
+// Default values of HandlerOptions
+const (
+	defaultHeartbeat    = 15 * time.Second
+	defaultHistory      = 100
+	defaultClientBuffer = 16
+)
+
+// Policy for a client whose buffer is full
+type OverflowPolicy int
+
+const (
+	// The client is disconnected, and can resume by Last-Event-ID
+	OverflowDisconnect OverflowPolicy = iota
+	// Events are dropped for the client
+	OverflowDrop
+)
+
+// Options of Handler
+type HandlerOptions[T any] struct {
+	// Encode converts a value to Event, whose ID is set by Handler.
+	// Values are encoded to JSON data if nil.
+	// Values failed to be encoded are skipped.
+	Encode func(T) (Event, error)
+
+	// Interval of comments sent to keep connections alive.
+	// Zero means 15 sec, and negative means no heartbeat.
+	Heartbeat time.Duration
+
+	// Number of the latest events kept for clients resuming by Last-Event-ID.
+	// Zero means 100.
+	History int
+
+	// Number of events buffered for each client.
+	// Zero means 16.
+	ClientBuffer int
+
+	// Policy for a client whose buffer is full
+	Overflow OverflowPolicy
+
+	// Reconnection time advised to clients, not sent if zero
+	Retry time.Duration
+}
+
+// Event with sequence number
+type seqEvent struct {
+	seq uint64
+	ev  Event
+}
+
+// Connected client of Handler
+type sseClient struct {
+	events chan seqEvent // closed when the client is disconnected by Handler
+}
+
+// Handler is http.Handler which streams values of a channel to clients as Server-Sent Events.
+//
+// Each value is broadcast to all clients connected at that time, with sequential ID.
+// A slow client does not block the others, see OverflowPolicy.
+type Handler[T any] struct {
+	opts HandlerOptions[T]
+
+	mu      sync.Mutex
+	seq     uint64
+	history []seqEvent // the latest events in the order of seq
+	clients map[*sseClient]struct{}
+	closed  bool // whether in is closed or ctx is done
+}
+
+// NewHandler returns Handler streaming values received from in.
+//
+// Streams of all clients end when in is closed or ctx is done.
+// After that, clients get the rest of the history or 204 No Content,
+// which tells clients not to reconnect.
+func NewHandler[T any](ctx context.Context, in <-chan T, opts HandlerOptions[T]) *Handler[T] {
+	if opts.Encode == nil {
+		opts.Encode = encodeJSON[T]
+	}
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = defaultHeartbeat
+	}
+	if opts.History <= 0 {
+		opts.History = defaultHistory
+	}
+	if opts.ClientBuffer <= 0 {
+		opts.ClientBuffer = defaultClientBuffer
+	}
+	h := &Handler[T]{
+		opts:    opts,
+		clients: map[*sseClient]struct{}{},
+	}
+	go h.broadcast(ctx, in)
+	return h
+}
+
+// Encode value to JSON data
+func encodeJSON[T any](v T) (Event, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Data: string(data)}, nil
+}
+
+// Send values received from in to all clients
+func (h *Handler[T]) broadcast(ctx context.Context, in <-chan T) {
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.closed = true
+		for c := range h.clients {
+			close(c.events)
+			delete(h.clients, c)
+		}
+	}()
+	for v := range pl.OrDone(ctx.Done(), nil, in) {
+		ev, err := h.opts.Encode(v)
+		if err != nil {
+			continue
+		}
+		h.mu.Lock()
+		h.seq++
+		ev.ID = strconv.FormatUint(h.seq, 10)
+		se := seqEvent{seq: h.seq, ev: ev}
+		h.history = append(h.history, se)
+		if len(h.history) > h.opts.History {
+			h.history = h.history[len(h.history)-h.opts.History:]
+		}
+		for c := range h.clients {
+			select {
+			case c.events <- se:
+			default:
+				if h.opts.Overflow == OverflowDisconnect {
+					close(c.events)
+					delete(h.clients, c)
+				}
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Register a client, and return events in history after lastID.
+//
+// The client is nil if Handler is closed.
+func (h *Handler[T]) connect(lastID string) (*sseClient, []seqEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var replay []seqEvent
+	if lastID != "" {
+		// unknown ID resumes from the oldest event in history
+		last, _ := strconv.ParseUint(lastID, 10, 64)
+		for _, se := range h.history {
+			if se.seq > last {
+				replay = append(replay, se)
+			}
+		}
+	}
+	if h.closed {
+		return nil, replay
+	}
+	c := &sseClient{events: make(chan seqEvent, h.opts.ClientBuffer)}
+	h.clients[c] = struct{}{}
+	return c, replay
+}
+
+// Unregister a client if it is not disconnected by Handler
+func (h *Handler[T]) disconnect(c *sseClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+// ServeHTTP streams events until the request is done or the stream ends
+func (h *Handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	c, replay := h.connect(r.Header.Get("Last-Event-ID"))
+	if c == nil && len(replay) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if c != nil {
+		defer h.disconnect(c)
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if h.opts.Retry > 0 {
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", h.opts.Retry.Milliseconds()); err != nil {
+			return
+		}
+	}
+	for _, se := range replay {
+		if err := writeEvent(w, se.ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	if c == nil {
+		return
+	}
+
+	var heartbeat <-chan time.Time
+	if h.opts.Heartbeat > 0 {
+		ticker := time.NewTicker(h.opts.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case se, ok := <-c.events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, se.ev); err != nil {
+				return
+			}
+			// write the buffered events at once
+			for n := len(c.events); n > 0; n-- {
+				if se, ok = <-c.events; !ok {
+					break
+				}
+				if err := writeEvent(w, se.ev); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ssepl
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Connect to the server and return the response
+func get(t *testing.T, url string, lastID string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// Receive n events from resp, or fail after timeout
+func receiveEvents(t *testing.T, resp *http.Response, n int) []Event {
+	t.Helper()
+	c, errc := Read(context.Background(), resp.Body)
+	got := []Event{}
+	timeout := time.After(time.Second)
+	for len(got) < n {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				t.Fatalf("stream ended with %v, received %v", <-errc, got)
+			}
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("timeout, received %v", got)
+		}
+	}
+	return got
+}
+
+func TestHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string)
+	srv := httptest.NewServer(NewHandler(ctx, in, HandlerOptions[string]{}))
+	defer srv.Close()
+	// streams end before the server is closed
+	defer cancel()
+
+	resp1 := get(t, srv.URL, "")
+	resp2 := get(t, srv.URL, "")
+	if ct := resp1.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	in <- "a"
+	in <- "b"
+	want := []Event{{ID: "1", Data: `"a"`}, {ID: "2", Data: `"b"`}}
+	for i, resp := range []*http.Response{resp1, resp2} {
+		if got := receiveEvents(t, resp, 2); !reflect.DeepEqual(got, want) {
+			t.Errorf("client %d received %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestHandlerResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID string
+		want   []Event
+	}{
+		{
+			name:   "resume after ID",
+			lastID: "2",
+			want:   []Event{{ID: "3", Data: "c"}, {ID: "4", Data: "d"}},
+		},
+		{
+			name:   "resume from the oldest in history",
+			lastID: "unknown",
+			want:   []Event{{ID: "2", Data: "b"}, {ID: "3", Data: "c"}, {ID: "4", Data: "d"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			in := make(chan string)
+			h := NewHandler(ctx, in, HandlerOptions[string]{
+				Encode:  func(v string) (Event, error) { return Event{Data: v}, nil },
+				History: 3,
+			})
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+			defer cancel()
+			for _, v := range []string{"a", "b", "c", "d"} {
+				in <- v
+			}
+			// wait until the last value is broadcast
+			resp := get(t, srv.URL, "3")
+			receiveEvents(t, resp, 1)
+
+			resp = get(t, srv.URL, tt.lastID)
+			if got := receiveEvents(t, resp, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerClosed(t *testing.T) {
+	in := make(chan string, 2)
+	in <- "a"
+	in <- "b"
+	close(in)
+	h := NewHandler(context.Background(), in, HandlerOptions[string]{})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// wait until in is closed
+	for closed := false; !closed; {
+		h.mu.Lock()
+		closed = h.closed
+		h.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	// the rest of history is sent, then the stream ends
+	resp := get(t, srv.URL, "0")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	c, errc := Read(context.Background(), resp.Body)
+	var got []string
+	for ev := range c {
+		got = append(got, ev.Data)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`"a"`, `"b"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %v, want %v", got, want)
+	}
+	if resp := get(t, srv.URL, "2"); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+	if resp := get(t, srv.URL, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestHandlerHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewHandler(ctx, make(chan string), HandlerOptions[string]{
+		Heartbeat: 10 * time.Millisecond,
+		Retry:     time.Second,
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer cancel()
+
+	r := bufio.NewReader(get(t, srv.URL, "").Body)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	want := []string{"retry: 1000", "", ": heartbeat", ""}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("stream = %q, want %q", lines, want)
+	}
+}
+
+func TestHandlerOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow OverflowPolicy
+		// expected events buffered for the client
+		want []string
+		// whether the client is disconnected
+		wantClosed bool
+	}{
+		{
+			name:       "disconnect",
+			overflow:   OverflowDisconnect,
+			want:       []string{"1", "2"},
+			wantClosed: true,
+		},
+		{
+			name:       "drop",
+			overflow:   OverflowDrop,
+			want:       []string{"1", "2"},
+			wantClosed: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			in := make(chan string)
+			h := NewHandler(ctx, in, HandlerOptions[string]{
+				ClientBuffer: 2,
+				Overflow:     tt.overflow,
+			})
+			// the slow client does not receive events
+			slow, _ := h.connect("")
+			fast, _ := h.connect("")
+			for _, v := range []string{"a", "b", "c"} {
+				in <- v
+				<-fast.events
+			}
+			var got []string
+			for n := len(slow.events); n > 0; n-- {
+				got = append(got, (<-slow.events).ev.ID)
+			}
+			h.mu.Lock()
+			_, connected := h.clients[slow]
+			h.mu.Unlock()
+			closed := !connected
+			if !reflect.DeepEqual(got, tt.want) || closed != tt.wantClosed {
+				t.Errorf("slow client received %v, closed %v, want %v, closed %v", got, closed, tt.want, tt.wantClosed)
+			}
+		})
+	}
+}
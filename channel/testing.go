@@ -22,70 +22,41 @@ package channel
 import (
 	"context"
 
+	"github.com/ezotaka/golib/channel/internal/pl"
 	"github.com/ezotaka/golib/conv"
 	"github.com/ezotaka/golib/eztest"
 )
 
-// TODO: copy and paste from ctxpl package
-// return channel which is closed when channel or done is closed
-func orDone[T any](
-	ctx context.Context,
-	channel <-chan T,
-) <-chan T {
+// return channel which can be cancelled by context
+//
+// If the context has count to cancel, the context is cancelled
+// with eztest.ErrCountCancel after the count of values is received.
+func withCountCancel[T any](ctx context.Context, c <-chan T) <-chan T {
+	cnt, ok := eztest.CountToCancel(ctx)
+	if !ok {
+		return pl.OrDone(ctx.Done(), nil, c)
+	}
 	valChan := make(chan T)
 	go func() {
 		defer close(valChan)
-		for {
+		for i := 0; i < cnt; i++ {
 			select {
 			case <-ctx.Done():
 				return
-			case v, ok := <-channel:
+			case v, ok := <-c:
 				if !ok {
 					return
 				}
 				select {
-				case valChan <- v:
 				case <-ctx.Done():
-				}
-			}
-		}
-	}()
-	return valChan
-}
-
-func take[T any](
-	ctx context.Context,
-	valueChan <-chan T,
-	num int,
-) <-chan T {
-	if valueChan == nil {
-		return nil
-	}
-	takeChan := make(chan T)
-	go func() {
-		defer close(takeChan)
-		for i := 0; i < num; i++ {
-			select {
-			case <-ctx.Done():
-				return
-			case v, ok := <-valueChan:
-				if !ok {
 					return
+				case valChan <- v:
 				}
-				takeChan <- v
 			}
 		}
+		eztest.CancelByCount(ctx)
 	}()
-	return takeChan
-}
-
-// return channel which can be cancelled by context
-func withCountCancel[T any](ctx context.Context, c <-chan T) <-chan T {
-	if cnt, ok := eztest.CountToCancel(ctx); ok {
-		return orDone(ctx, take(ctx, c, cnt))
-	} else {
-		return orDone(ctx, c)
-	}
+	return valChan
 }
 
 // RunTest channel test using test case defined by Case
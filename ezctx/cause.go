@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ezctx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDoneClosed is the cause of context cancelled by closing done channel of WithDone
+var ErrDoneClosed = errors.New("done channel closed")
+
+// CancelCauseFunc cancels context with cause.
+//
+// Nil cause is regarded as context.Canceled.
+// Only the first cause is recorded.
+type CancelCauseFunc func(cause error)
+
+// Type of context key
+type ctxKey int
+
+const (
+	// Key to find the nearest causeCtx
+	causeCtxKey ctxKey = iota
+)
+
+// Context which records cause of cancellation
+type causeCtx struct {
+	context.Context
+	parent context.Context
+
+	mu    sync.Mutex
+	cause error
+}
+
+func (c *causeCtx) Value(key any) any {
+	if key == causeCtxKey {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+func (c *causeCtx) cancel(cause error, cancel context.CancelFunc) {
+	if cause == nil {
+		cause = context.Canceled
+	}
+	c.mu.Lock()
+	if c.cause == nil && c.Context.Err() == nil {
+		c.cause = cause
+	}
+	c.mu.Unlock()
+	cancel()
+}
+
+// WithCancelCause returns context which is cancelled with cause by CancelCauseFunc.
+//
+// It works like context.WithCancelCause of Go 1.20 and later.
+// The cause can be taken by Cause.
+func WithCancelCause(parent context.Context) (context.Context, CancelCauseFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	c := &causeCtx{Context: ctx, parent: parent}
+	return c, func(cause error) {
+		c.cancel(cause, cancel)
+	}
+}
+
+// Cause returns why ctx is cancelled.
+//
+// It returns nil if ctx is not done.
+// It returns the cause given to CancelCauseFunc of the nearest context
+// made by WithCancelCause, or ctx.Err() if there is no cause.
+func Cause(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	c, ok := ctx.Value(causeCtxKey).(*causeCtx)
+	if !ok {
+		return ctx.Err()
+	}
+	if c.Err() == nil {
+		// ctx is cancelled by itself, e.g. timeout of derived context
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	cause := c.cause
+	c.mu.Unlock()
+	if cause != nil {
+		return cause
+	}
+	// c is cancelled by its parent
+	return Cause(c.parent)
+}
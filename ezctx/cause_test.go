@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ezctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCause(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	tests := []struct {
+		name string
+		// returns context to be checked
+		ctx  func() context.Context
+		want error
+	}{
+		{
+			name: "not cancelled",
+			ctx: func() context.Context {
+				ctx, _ := WithCancelCause(context.Background())
+				return ctx
+			},
+			want: nil,
+		},
+		{
+			name: "cancelled with cause",
+			ctx: func() context.Context {
+				ctx, cancel := WithCancelCause(context.Background())
+				cancel(errA)
+				return ctx
+			},
+			want: errA,
+		},
+		{
+			name: "first cause wins",
+			ctx: func() context.Context {
+				ctx, cancel := WithCancelCause(context.Background())
+				cancel(errA)
+				cancel(errB)
+				return ctx
+			},
+			want: errA,
+		},
+		{
+			name: "nil cause",
+			ctx: func() context.Context {
+				ctx, cancel := WithCancelCause(context.Background())
+				cancel(nil)
+				return ctx
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "cancelled by parent with cause",
+			ctx: func() context.Context {
+				parent, cancel := WithCancelCause(context.Background())
+				ctx, _ := WithCancelCause(context.WithValue(parent, ctxKey(-1), 0))
+				cancel(errA)
+				return ctx
+			},
+			want: errA,
+		},
+		{
+			name: "timeout of derived context",
+			ctx: func() context.Context {
+				parent, _ := WithCancelCause(context.Background())
+				ctx, cancel := context.WithTimeout(parent, time.Nanosecond)
+				defer cancel()
+				<-ctx.Done()
+				return ctx
+			},
+			want: context.DeadlineExceeded,
+		},
+		{
+			name: "no cause context",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "done channel closed",
+			ctx: func() context.Context {
+				done := make(chan struct{})
+				ctx, _ := WithDone(context.Background(), done)
+				close(done)
+				<-ctx.Done()
+				return ctx
+			},
+			want: ErrDoneClosed,
+		},
+		{
+			name: "WithDone cancelled by cancel func",
+			ctx: func() context.Context {
+				ctx, cancel := WithDone(context.Background(), make(chan struct{}))
+				cancel()
+				return ctx
+			},
+			want: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Cause(tt.ctx()); !errors.Is(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("Cause() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -24,20 +24,33 @@ import (
 )
 
 // Return context cancelled when done channel is closed
-func WithDone[T any](done <-chan T) context.Context {
-	ctx, cancel := context.WithCancel(context.Background())
+//
+// The returned context inherits values and deadline of parent.
+// Its cause of cancellation given by Cause is ErrDoneClosed when done is closed.
+// Nil done is regarded as closed channel.
+// Calling cancel releases the goroutine watching done,
+// so cancel should be called as soon as the context is no longer used.
+func WithDone[T any](
+	parent context.Context,
+	done <-chan T,
+) (context.Context, context.CancelFunc) {
+	ctx, cancelCause := WithCancelCause(parent)
+	cancel := func() { cancelCause(context.Canceled) }
 	if done == nil {
-		cancel()
-	} else {
-		select {
-		case <-done:
-			cancel()
-		default:
-			go func() {
-				<-done
-				cancel()
-			}()
-		}
+		cancelCause(ErrDoneClosed)
+		return ctx, cancel
+	}
+	select {
+	case <-done:
+		cancelCause(ErrDoneClosed)
+	default:
+		go func() {
+			select {
+			case <-done:
+				cancelCause(ErrDoneClosed)
+			case <-ctx.Done():
+			}
+		}()
 	}
-	return ctx
+	return ctx, cancel
 }
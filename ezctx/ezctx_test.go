@@ -17,14 +17,16 @@
 // IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
-package ezctx
+package ezctx_test
 
 import (
+	"context"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/ezotaka/golib/channel/ctxpl"
+	"github.com/ezotaka/golib/ezctx"
 )
 
 func TestWithDone(t *testing.T) {
@@ -66,7 +68,8 @@ func TestWithDone(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			ctx := WithDone(tt.args.done)
+			ctx, cancel := ezctx.WithDone(context.Background(), tt.args.done)
+			defer cancel()
 			c := ctxpl.Repeat(ctx, 1)
 			got := []int{}
 			for v := range c {
@@ -82,3 +85,66 @@ func TestWithDone(t *testing.T) {
 		})
 	}
 }
+
+func TestWithDoneParent(t *testing.T) {
+	type ctxKey int
+	const key ctxKey = 0
+	background := context.WithValue(context.Background(), key, "value")
+	cancelled, cancelParent := context.WithCancel(background)
+	cancelParent()
+	type args struct {
+		parent context.Context
+		cancel bool
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantDone bool
+	}{
+		{
+			name: "not done",
+			args: args{
+				parent: background,
+			},
+			wantDone: false,
+		},
+		{
+			name: "parent cancelled",
+			args: args{
+				parent: cancelled,
+			},
+			wantDone: true,
+		},
+		{
+			name: "cancel func called",
+			args: args{
+				parent: background,
+				cancel: true,
+			},
+			wantDone: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := ezctx.WithDone(tt.args.parent, make(chan struct{}))
+			defer cancel()
+			if tt.args.cancel {
+				cancel()
+			}
+			if got := ctx.Value(key); got != "value" {
+				t.Errorf("WithDone() value = %v, want %v", got, "value")
+			}
+			gotDone := false
+			select {
+			case <-ctx.Done():
+				gotDone = true
+			case <-time.After(100 * time.Millisecond):
+			}
+			if gotDone != tt.wantDone {
+				t.Errorf("WithDone() done = %v, want %v", gotDone, tt.wantDone)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ezctx
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalError is the cause of context cancelled by signal of WithSignals
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return "received signal: " + e.Signal.String()
+}
+
+// WithSignals returns contexts cancelled by signals for graceful-then-forced shutdown.
+//
+// ctx is cancelled on the first signal, and force is cancelled on the second one.
+// Their cause given by Cause is *SignalError. After the second signal,
+// signals are handled by default again, so the third one may exit the process.
+// Both inherit values and deadline of parent, and force is not cancelled by ctx.
+// SIGINT and SIGTERM are handled if sigs is empty.
+// Calling stop cancels both and stops handling signals,
+// so stop should be called as soon as the contexts are no longer used.
+func WithSignals(
+	parent context.Context,
+	sigs ...os.Signal,
+) (ctx context.Context, force context.Context, stop context.CancelFunc) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, cancel := WithCancelCause(parent)
+	force, cancelForce := WithCancelCause(parent)
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, sigs...)
+	go func() {
+		defer signal.Stop(sigChan)
+		for _, c := range []CancelCauseFunc{cancel, cancelForce} {
+			select {
+			case sig := <-sigChan:
+				c(&SignalError{Signal: sig})
+			case <-force.Done():
+				// stopped or parent is done
+				return
+			}
+		}
+	}()
+	return ctx, force, func() {
+		cancel(context.Canceled)
+		cancelForce(context.Canceled)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ezctx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Send sig to this process, or skip the test if it is not supported
+func sendSignal(t *testing.T, sig os.Signal) {
+	t.Helper()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(sig); err != nil {
+		t.Skipf("signal is not supported: %v", err)
+	}
+}
+
+// Wait until ctx is done, or fail after timeout
+func waitDone(t *testing.T, ctx context.Context, name string) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("%s is not done", name)
+	}
+}
+
+func TestWithSignals(t *testing.T) {
+	ctx, force, stop := WithSignals(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	sendSignal(t, syscall.SIGTERM)
+	waitDone(t, ctx, "ctx")
+	var sigErr *SignalError
+	if cause := Cause(ctx); !errors.As(cause, &sigErr) || sigErr.Signal != syscall.SIGTERM {
+		t.Errorf("Cause(ctx) = %v, want SIGTERM", cause)
+	}
+	select {
+	case <-force.Done():
+		t.Fatalf("force is done by the first signal")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	waitDone(t, force, "force")
+	if cause := Cause(force); !errors.As(cause, &sigErr) || sigErr.Signal != syscall.SIGTERM {
+		t.Errorf("Cause(force) = %v, want SIGTERM", cause)
+	}
+}
+
+func TestWithSignalsStop(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop contexts
+		stop func(cancelParent context.CancelFunc, stop context.CancelFunc)
+		want error
+	}{
+		{
+			name: "stop",
+			stop: func(_ context.CancelFunc, stop context.CancelFunc) { stop() },
+			want: context.Canceled,
+		},
+		{
+			name: "parent is done",
+			stop: func(cancelParent context.CancelFunc, _ context.CancelFunc) { cancelParent() },
+			want: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, cancelParent := context.WithCancel(context.Background())
+			defer cancelParent()
+			ctx, force, stop := WithSignals(parent)
+			defer stop()
+			tt.stop(cancelParent, stop)
+			waitDone(t, ctx, "ctx")
+			waitDone(t, force, "force")
+			if cause := Cause(ctx); !errors.Is(cause, tt.want) {
+				t.Errorf("Cause(ctx) = %v, want %v", cause, tt.want)
+			}
+			if cause := Cause(force); !errors.Is(cause, tt.want) {
+				t.Errorf("Cause(force) = %v, want %v", cause, tt.want)
+			}
+		})
+	}
+}
@@ -42,6 +42,27 @@ func Wrap(err error, msg string, msgArgs ...any) *Error {
 	}
 }
 
+// FromPanic returns Error including details of value recovered from panic
+//
+// The recovered value is stored in Misc["panic"].
+// It should be called in the deferred function to keep the stack trace of panic.
+func FromPanic(r any) *Error {
+	inner, _ := r.(error)
+	e := Wrap(inner, "panic: %v", r)
+	e.Misc["panic"] = r
+	return e
+}
+
+// Recover stores Error converted from panic to *errp, and stops the panic.
+//
+// It must be deferred directly, e.g. defer ezerr.Recover(&err),
+// since recover works only in the deferred function.
+func Recover(errp *error) {
+	if r := recover(); r != nil {
+		*errp = FromPanic(r)
+	}
+}
+
 func (e *Error) Error() string {
 	return e.Message
 }
@@ -21,9 +21,21 @@ package eztest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"time"
+
+	"github.com/ezotaka/golib/ezctx"
+)
+
+// Causes of cancellation of context given to the function to be tested.
+// They can be taken by ezctx.Cause.
+var (
+	// Run finished the test
+	ErrTestFinished = errors.New("test finished")
+	// The count given by ContextWithCountCancel is reached
+	ErrCountCancel = errors.New("count to cancel reached")
 )
 
 // Type of context key
@@ -32,6 +44,8 @@ type ctxKey int
 const (
 	// Key of count to cancel channel
 	countToCancelKey ctxKey = iota
+	// Key of ezctx.CancelCauseFunc of Run
+	cancelCauseKey
 )
 
 // TODO: replace with receiver
@@ -51,15 +65,26 @@ func ContextWithCountCancel(cnt int) context.Context {
 	return context.WithValue(context.Background(), countToCancelKey, cnt)
 }
 
+// CancelByCount cancels context given by Run with cause ErrCountCancel.
+//
+// It is called when the count given by ContextWithCountCancel is reached.
+// It does nothing if ctx is not given by Run.
+func CancelByCount(ctx context.Context) {
+	if cancel, ok := ctx.Value(cancelCauseKey).(ezctx.CancelCauseFunc); ok {
+		cancel(ErrCountCancel)
+	}
+}
+
+// Get context cancelled after t with cause context.DeadlineExceeded
 func ContextWithTimeout(t time.Duration) context.Context {
 	//ctx, _ := context.WithTimeout(context.Background(), t)
 	//* above code is warned like below
 	// the cancel function returned by context.WithTimeout should be called, not discarded, to avoid a context leak
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := ezctx.WithCancelCause(context.Background())
 	go func() {
 		time.Sleep(t)
-		cancel()
+		cancel(context.DeadlineExceeded)
 	}()
 	return ctx
 }
@@ -185,8 +210,9 @@ func Run[
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	ctx, cancel := ezctx.WithCancelCause(ctx)
+	defer cancel(ErrTestFinished)
+	ctx = context.WithValue(ctx, cancelCauseKey, cancel)
 
 	// invoke the method to be tested
 	testedVal, testedErr := tc.Invoker.Invoke(ctx, tc.Args)
@@ -25,6 +25,9 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/ezctx"
 )
 
 func TestContextWithCountCancel(t *testing.T) {
@@ -326,3 +329,66 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestCancelCause(t *testing.T) {
+	type args struct {
+		ctx context.Context
+	}
+	tests := []struct {
+		name string
+		args args
+		// stop the test by CancelByCount
+		byCount bool
+		want    error
+	}{
+		{
+			name: "test finished",
+			args: args{
+				ctx: context.Background(),
+			},
+			want: ErrTestFinished,
+		},
+		{
+			name: "count to cancel",
+			args: args{
+				ctx: ContextWithCountCancel(1),
+			},
+			byCount: true,
+			want:    ErrCountCancel,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got context.Context
+			tc := Case[args, int, int]{
+				Context: tt.args.ctx,
+				Invoker: Invoker[args, int]{
+					Name: "cause",
+					Invoke: func(ctx context.Context, a args) (int, error) {
+						got = ctx
+						if tt.byCount {
+							CancelByCount(ctx)
+						}
+						return 0, nil
+					},
+				},
+			}
+			Run(tc, func(_ context.Context, r int, err error) (int, error) {
+				return r, err
+			})
+			if cause := ezctx.Cause(got); !errors.Is(cause, tt.want) {
+				t.Errorf("ezctx.Cause() = %v, want %v", cause, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextWithTimeoutCause(t *testing.T) {
+	ctx := ContextWithTimeout(time.Millisecond)
+	<-ctx.Done()
+	if cause := ezctx.Cause(ctx); !errors.Is(cause, context.DeadlineExceeded) {
+		t.Errorf("ezctx.Cause() = %v, want %v", cause, context.DeadlineExceeded)
+	}
+}
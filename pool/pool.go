@@ -0,0 +1,239 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package pool provides worker pool and weighted semaphore for channel pipelines.
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ezotaka/golib/channel/ctxpl"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+// Options of WorkerPool
+type Options[T any] struct {
+	// Initial number of workers.
+	// Zero means 1.
+	Workers int
+
+	// Semaphore acquired by each job in addition to a worker, if not nil
+	Semaphore *Semaphore
+
+	// Weight of job acquired from Semaphore.
+	// Nil means every job weighs 1.
+	Weight func(T) int64
+}
+
+// Pool of workers which apply function to jobs received from channel
+//
+// The number of workers can be changed by Resize while running.
+type WorkerPool[T any, R any] struct {
+	fn   func(context.Context, T) (R, error)
+	opts Options[T]
+
+	mu      sync.Mutex
+	size    int
+	quits   []chan struct{} // quit channel of each running worker
+	active  int             // workers not exited yet
+	running bool            // Run is called
+	ended   bool            // jobs are closed or ctx is done
+	closed  bool            // results channel is closed
+
+	ctx     context.Context
+	jobs    <-chan T
+	results chan ctxpl.Result[T, R]
+	stop    chan struct{} // closed when ended
+}
+
+// New returns WorkerPool which applies fn to each job
+func New[T any, R any](
+	fn func(context.Context, T) (R, error),
+	opts Options[T],
+) *WorkerPool[T, R] {
+	if fn == nil {
+		panic("fn must not be nil")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Weight == nil {
+		opts.Weight = func(T) int64 { return 1 }
+	}
+	return &WorkerPool[T, R]{
+		fn:   fn,
+		opts: opts,
+		size: opts.Workers,
+	}
+}
+
+// Run starts workers which receive jobs, and returns channel of results.
+//
+// The results channel is closed after jobs is closed or ctx is done,
+// and all running jobs are finished.
+// Panic in fn is returned as *ezerr.Error in Result.Err.
+// It panics if Run is called twice.
+func (p *WorkerPool[T, R]) Run(ctx context.Context, jobs <-chan T) <-chan ctxpl.Result[T, R] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		panic("Run must not be called twice")
+	}
+	p.running = true
+	p.ctx = ctx
+	p.jobs = jobs
+	p.results = make(chan ctxpl.Result[T, R])
+	p.stop = make(chan struct{})
+	p.resize()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.end()
+		case <-p.stop:
+		}
+	}()
+	return p.results
+}
+
+// Size returns the number of workers
+func (p *WorkerPool[T, R]) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Resize changes the number of workers to n.
+//
+// Removed workers exit after finishing their current job.
+// Zero workers pause the pool.
+func (p *WorkerPool[T, R]) Resize(n int) {
+	if n < 0 {
+		panic("n must be zero or positive")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = n
+	if p.running {
+		p.resize()
+	}
+}
+
+// Start or stop workers to match size. p.mu must be locked.
+func (p *WorkerPool[T, R]) resize() {
+	if p.ended {
+		return
+	}
+	for len(p.quits) < p.size {
+		quit := make(chan struct{})
+		p.quits = append(p.quits, quit)
+		p.active++
+		go p.work(quit)
+	}
+	for len(p.quits) > p.size {
+		last := len(p.quits) - 1
+		close(p.quits[last])
+		p.quits = p.quits[:last]
+	}
+}
+
+// Mark jobs are closed or ctx is done
+func (p *WorkerPool[T, R]) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ended {
+		return
+	}
+	p.ended = true
+	close(p.stop)
+	p.closeIfDone()
+}
+
+// Close results if no more result is sent. p.mu must be locked.
+func (p *WorkerPool[T, R]) closeIfDone() {
+	if p.ended && p.active == 0 && !p.closed {
+		p.closed = true
+		close(p.results)
+	}
+}
+
+// Worker loop which exits when quit is closed
+func (p *WorkerPool[T, R]) work(quit chan struct{}) {
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.active--
+		// remove quit if the worker exits by itself
+		for i, q := range p.quits {
+			if q == quit {
+				p.quits = append(p.quits[:i], p.quits[i+1:]...)
+				break
+			}
+		}
+		p.closeIfDone()
+	}()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-p.stop:
+			return
+		case v, ok := <-p.jobs:
+			if !ok {
+				p.end()
+				return
+			}
+			w := p.opts.Weight(v)
+			sem := p.opts.Semaphore
+			if sem != nil {
+				if err := sem.Acquire(p.ctx, w); err != nil {
+					p.send(ctxpl.Result[T, R]{In: v, Err: err})
+					continue
+				}
+			}
+			r := p.call(v)
+			if sem != nil {
+				sem.Release(w)
+			}
+			if !p.send(r) {
+				return
+			}
+		}
+	}
+}
+
+// Send result, and report whether it is sent before ctx is done
+func (p *WorkerPool[T, R]) send(r ctxpl.Result[T, R]) bool {
+	select {
+	case <-p.ctx.Done():
+		return false
+	case p.results <- r:
+		return true
+	}
+}
+
+// Call fn converting panic to *ezerr.Error
+func (p *WorkerPool[T, R]) call(v T) (r ctxpl.Result[T, R]) {
+	r.In = v
+	defer ezerr.Recover(&r.Err)
+	r.Out, r.Err = p.fn(p.ctx, v)
+	return
+}
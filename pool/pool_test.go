@@ -0,0 +1,221 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezotaka/golib/conv"
+	"github.com/ezotaka/golib/ezerr"
+)
+
+func TestWorkerPool(t *testing.T) {
+	errFail := errors.New("fail")
+	fn := func(_ context.Context, v int) (int, error) {
+		switch {
+		case v < 0:
+			return 0, errFail
+		case v == 0:
+			panic("zero")
+		}
+		return v * 10, nil
+	}
+	tests := []struct {
+		name    string
+		workers int
+		jobs    []int
+		want    map[int]int
+		wantErr map[int]error
+	}{
+		{
+			name:    "1 worker",
+			workers: 1,
+			jobs:    []int{1, 2, 3},
+			want:    map[int]int{1: 10, 2: 20, 3: 30},
+			wantErr: map[int]error{},
+		},
+		{
+			name:    "4 workers with error and panic",
+			workers: 4,
+			jobs:    []int{1, -1, 0, 2},
+			want:    map[int]int{1: 10, -1: 0, 0: 0, 2: 20},
+			wantErr: map[int]error{-1: errFail, 0: &ezerr.Error{}},
+		},
+		{
+			name:    "no jobs",
+			workers: 2,
+			jobs:    []int{},
+			want:    map[int]int{},
+			wantErr: map[int]error{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := New(fn, Options[int]{Workers: tt.workers})
+			got := map[int]int{}
+			for r := range p.Run(context.Background(), conv.Chan(tt.jobs...)) {
+				got[r.In] = r.Out
+				want := tt.wantErr[r.In]
+				var ee *ezerr.Error
+				switch {
+				case want == nil && r.Err != nil:
+					t.Errorf("job %d error = %v, want nil", r.In, r.Err)
+				case errors.As(want, &ee):
+					if !errors.As(r.Err, &ee) || ee.Misc["panic"] != "zero" {
+						t.Errorf("job %d error = %#v, want *ezerr.Error", r.In, r.Err)
+					}
+				case want != nil && !errors.Is(r.Err, want):
+					t.Errorf("job %d error = %v, want %v", r.In, r.Err, want)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Count maximum number of concurrent calls
+type concurrency struct {
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (c *concurrency) enter() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur++
+	if c.cur > c.max {
+		c.max = c.cur
+	}
+}
+
+func (c *concurrency) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur--
+}
+
+func (c *concurrency) reset() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	max := c.max
+	c.max = c.cur
+	return max
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	c := &concurrency{}
+	fn := func(_ context.Context, v int) (int, error) {
+		c.enter()
+		defer c.leave()
+		time.Sleep(5 * time.Millisecond)
+		return v, nil
+	}
+	jobs := make(chan int)
+	p := New(fn, Options[int]{Workers: 1})
+	results := p.Run(context.Background(), jobs)
+	go func() {
+		for range results {
+		}
+	}()
+
+	run := func(n int) int {
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		time.Sleep(10 * time.Millisecond)
+		return c.reset()
+	}
+	if got := run(8); got != 1 {
+		t.Errorf("concurrency = %d, want 1", got)
+	}
+	p.Resize(4)
+	if got := run(16); got != 4 {
+		t.Errorf("concurrency after Resize(4) = %d, want 4", got)
+	}
+	p.Resize(2)
+	time.Sleep(10 * time.Millisecond)
+	c.reset()
+	if got := run(16); got != 2 {
+		t.Errorf("concurrency after Resize(2) = %d, want 2", got)
+	}
+	if got := p.Size(); got != 2 {
+		t.Errorf("Size() = %d, want 2", got)
+	}
+	close(jobs)
+}
+
+func TestWorkerPoolSemaphore(t *testing.T) {
+	c := &concurrency{}
+	fn := func(_ context.Context, v int64) (int64, error) {
+		c.enter()
+		defer c.leave()
+		time.Sleep(5 * time.Millisecond)
+		return v, nil
+	}
+	p := New(fn, Options[int64]{
+		Workers:   4,
+		Semaphore: NewSemaphore(4),
+		Weight:    func(v int64) int64 { return v },
+	})
+	got := []int64{}
+	for r := range p.Run(context.Background(), conv.Chan[int64](2, 2, 2, 2, 4, 5)) {
+		if r.In == 5 {
+			if !errors.Is(r.Err, ErrTooHeavy) {
+				t.Errorf("job %d error = %v, want %v", r.In, r.Err, ErrTooHeavy)
+			}
+			continue
+		}
+		got = append(got, r.Out)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if want := []int64{2, 2, 2, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+	if max := c.reset(); max > 2 {
+		t.Errorf("concurrency = %d, want <= 2", max)
+	}
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(func(ctx context.Context, v int) (int, error) {
+		return v, nil
+	}, Options[int]{Workers: 2})
+	results := p.Run(ctx, make(chan int))
+	cancel()
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Errorf("result is received, want closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("results is not closed by context")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pool
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrTooHeavy is returned by Semaphore.Acquire if weight exceeds the size of the semaphore
+var ErrTooHeavy = errors.New("weight exceeds size of semaphore")
+
+// ErrNegativeWeight is returned by Semaphore.Acquire if weight is negative
+var ErrNegativeWeight = errors.New("weight of semaphore is negative")
+
+// Waiter of Semaphore.Acquire
+type waiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+// Weighted semaphore
+//
+// Waiters acquire the semaphore in FIFO order,
+// so a heavy waiter is not starved by light ones.
+type Semaphore struct {
+	size    int64
+	mu      sync.Mutex
+	cur     int64
+	waiters list.List
+}
+
+// NewSemaphore returns Semaphore with total weight size
+func NewSemaphore(size int64) *Semaphore {
+	if size <= 0 {
+		panic("size must be positive")
+	}
+	return &Semaphore{size: size}
+}
+
+// Acquire acquires weight w, blocking until it is available or ctx is done.
+//
+// It returns ctx.Err() if ctx is done, and acquires nothing in that case.
+func (s *Semaphore) Acquire(ctx context.Context, w int64) error {
+	if w < 0 {
+		return ErrNegativeWeight
+	}
+	if w > s.size {
+		return ErrTooHeavy
+	}
+	s.mu.Lock()
+	if s.size-s.cur >= w && s.waiters.Len() == 0 {
+		s.cur += w
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(waiter{weight: w, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// acquired just after ctx is done
+			s.cur -= w
+			s.notify()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if isFront {
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	case <-ready:
+		return nil
+	}
+}
+
+// TryAcquire acquires weight w without blocking, and reports whether it succeeded.
+// It fails if w is negative.
+func (s *Semaphore) TryAcquire(w int64) bool {
+	if w < 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= w && s.waiters.Len() == 0 {
+		s.cur += w
+		return true
+	}
+	return false
+}
+
+// Release releases weight w.
+// It panics if w is negative.
+func (s *Semaphore) Release(w int64) {
+	if w < 0 {
+		panic("weight must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= w
+	if s.cur < 0 {
+		panic("released more than acquired")
+	}
+	s.notify()
+}
+
+// Wake waiters in order while their weight is available
+func (s *Semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(waiter)
+		if s.size-s.cur < w.weight {
+			return
+		}
+		s.cur += w.weight
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
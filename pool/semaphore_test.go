@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Takatomo Ezo
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(3)
+	ctx := context.Background()
+	if err := s.Acquire(ctx, 2); err != nil {
+		t.Fatalf("Acquire(2) error = %v", err)
+	}
+	if s.TryAcquire(2) {
+		t.Errorf("TryAcquire(2) = true, want false")
+	}
+	if err := s.Acquire(ctx, 4); !errors.Is(err, ErrTooHeavy) {
+		t.Errorf("Acquire(4) error = %v, want %v", err, ErrTooHeavy)
+	}
+
+	// heavy waiter blocks following light waiter
+	heavy := make(chan error)
+	go func() { heavy <- s.Acquire(ctx, 3) }()
+	time.Sleep(10 * time.Millisecond)
+	if s.TryAcquire(1) {
+		t.Errorf("TryAcquire(1) = true, want false while heavy waiter exists")
+	}
+	s.Release(2)
+	select {
+	case err := <-heavy:
+		if err != nil {
+			t.Errorf("Acquire(3) error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Acquire(3) is not woken up")
+	}
+	s.Release(3)
+	if !s.TryAcquire(3) {
+		t.Errorf("TryAcquire(3) = false, want true")
+	}
+}
+
+func TestSemaphoreCancel(t *testing.T) {
+	s := NewSemaphore(1)
+	s.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// cancelled waiter does not hold weight
+	s.Release(1)
+	if !s.TryAcquire(1) {
+		t.Errorf("TryAcquire(1) = false, want true")
+	}
+}
+
+func TestSemaphoreNegative(t *testing.T) {
+	s := NewSemaphore(1)
+	if err := s.Acquire(context.Background(), -1); !errors.Is(err, ErrNegativeWeight) {
+		t.Errorf("Acquire(-1) error = %v, want %v", err, ErrNegativeWeight)
+	}
+	if s.TryAcquire(-1) {
+		t.Errorf("TryAcquire(-1) = true, want false")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Release(-1) did not panic")
+			}
+		}()
+		s.Release(-1)
+	}()
+	// capacity is not grown
+	if !s.TryAcquire(1) || s.TryAcquire(1) {
+		t.Errorf("capacity of semaphore is changed")
+	}
+}